@@ -0,0 +1,241 @@
+// Package config loads podlist's configuration from flags, PODLIST_
+// environment variables and a YAML file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/abatilo/okteto-exercise/cmd/podlist/server"
+	"github.com/abatilo/okteto-exercise/internal"
+)
+
+// Config is every setting podlist has. Keys are the same in the YAML file and
+// on the command line, and PODLIST_ followed by the key in upper case with
+// dashes as underscores in the environment, like PODLIST_ADMIN_ADDR.
+//
+// Settings tagged live are applied when the file changes, the rest need a
+// restart.
+type Config struct {
+	Debug bool `mapstructure:"debug" live:"true"`
+
+	Addr            string        `mapstructure:"addr"`
+	AdminAddr       string        `mapstructure:"admin-addr"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown-timeout"`
+
+	Kubeconfig string   `mapstructure:"kubeconfig"`
+	Context    string   `mapstructure:"context"`
+	Namespaces []string `mapstructure:"namespaces"`
+
+	AgeFormat   string `mapstructure:"age-format" live:"true"`
+	AgeUnits    int    `mapstructure:"age-units" live:"true"`
+	DefaultSort string `mapstructure:"default-sort" live:"true"`
+
+	PodMetricsLimit int    `mapstructure:"pod-metrics-limit"`
+	OTLPEndpoint    string `mapstructure:"otlp-endpoint"`
+
+	AdminToken string `mapstructure:"admin-token"`
+
+	Auth                bool          `mapstructure:"auth"`
+	AuthCacheTTL        time.Duration `mapstructure:"auth-cache-ttl"`
+	AuthAnonymousRoutes []string      `mapstructure:"auth-anonymous-routes"`
+	AuthAudiences       []string      `mapstructure:"auth-audiences"`
+}
+
+// Settings are the parts of the configuration the server applies live
+func (c Config) Settings() server.Settings {
+	return server.Settings{
+		AgeFormat:   server.AgeFormat(c.AgeFormat),
+		AgeUnits:    c.AgeUnits,
+		DefaultSort: c.DefaultSort,
+	}
+}
+
+// Validate checks the configuration, listing every problem it finds
+func (c Config) Validate() error {
+	var problems []string
+	invalid := func(key string, err error) {
+		problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+	}
+
+	if err := validateAddr(c.Addr); err != nil {
+		invalid("addr", err)
+	}
+	if err := validateAddr(c.AdminAddr); err != nil {
+		invalid("admin-addr", err)
+	} else if c.AdminAddr == c.Addr {
+		invalid("admin-addr", errors.New("must be different from addr"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		invalid("shutdown-timeout", errors.New("must be greater than 0"))
+	}
+
+	for _, namespace := range c.Namespaces {
+		if namespace == internal.AllNamespaces {
+			if len(c.Namespaces) > 1 {
+				invalid("namespaces", fmt.Errorf("%q can't be combined with other namespaces", internal.AllNamespaces))
+			}
+			continue
+		}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			invalid("namespaces", fmt.Errorf("%q is not a valid namespace: %s", namespace, strings.Join(errs, ", ")))
+		}
+	}
+
+	if err := c.Settings().Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if c.PodMetricsLimit < 0 {
+		invalid("pod-metrics-limit", errors.New("can't be negative"))
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < minAdminTokenLength {
+		invalid("admin-token", fmt.Errorf("must be at least %d characters", minAdminTokenLength))
+	}
+	if c.AuthCacheTTL < 0 {
+		invalid("auth-cache-ttl", errors.New("can't be negative"))
+	}
+	for _, route := range c.AuthAnonymousRoutes {
+		if !strings.HasPrefix(route, "/") {
+			invalid("auth-anonymous-routes", fmt.Errorf("%q is not a route pattern, expected something like /api/v1/pods", route))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// minAdminTokenLength keeps the admin token from being guessable
+const minAdminTokenLength = 16
+
+func validateAddr(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("expected host:port or :port, got %q", addr)
+	}
+	return nil
+}
+
+// restartRequired lists the keys that differ between the configurations but
+// can't be applied live
+func (c Config) restartRequired(other Config) []string {
+	var keys []string
+	a, b := reflect.ValueOf(c), reflect.ValueOf(other)
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if field.Tag.Get("live") == "true" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			keys = append(keys, field.Tag.Get("mapstructure"))
+		}
+	}
+	return keys
+}
+
+// Loader reads the configuration. Flags that are set take precedence over
+// environment variables, which take precedence over the file passed with
+// --config, which takes precedence over the flags' defaults.
+type Loader struct {
+	v     *viper.Viper
+	flags *pflag.FlagSet
+
+	// loaded is the configuration podlist started with
+	loaded Config
+}
+
+// NewLoader defines every flag, name is the command's name for usage errors
+func NewLoader(name string) *Loader {
+	flags := pflag.NewFlagSet(name, pflag.ExitOnError)
+	flags.String("config", "", "Path to a YAML configuration file, which is watched for changes")
+	flags.Bool("debug", false, "Enable debug logging")
+	flags.String("addr", ":8080", "Address the API listens on")
+	flags.String("admin-addr", ":8081", "Address the admin server, with health checks, metrics and pprof, listens on")
+	flags.Duration("shutdown-timeout", server.DefaultShutdownTimeout, "How long to wait for requests to finish when shutting down")
+	flags.String("kubeconfig", "", "Path to a kubeconfig file, for running outside of a cluster")
+	flags.String("context", "", "Name of the kubeconfig context to use")
+	flags.StringSlice("namespaces", nil, "Namespaces to list pods from, defaults to the current namespace. Use '*' for every namespace")
+	flags.String("age-format", string(server.AgeFormatLong), "How ages are written, 'kubectl' for 3d4h or 'long' for 3 days 4 hours")
+	flags.Int("age-units", server.DefaultAgeUnits, "Number of units written by the long age format")
+	flags.String("default-sort", "", "Sort used when a request doesn't pass one, like '-restarts,name'. Defaults to sorting by name")
+	flags.Int("pod-metrics-limit", internal.DefaultPodMetricsLimit, "Maximum number of pods reported with their own series on /metrics")
+	flags.String("admin-token", "", "Token that authorizes changing the log level and debugging single requests. Prefer setting PODLIST_ADMIN_TOKEN, flags are visible to other processes")
+	flags.Bool("auth", false, "Require API requests to send a bearer token, which is checked with the Kubernetes TokenReview API")
+	flags.Duration("auth-cache-ttl", time.Minute, "How long checked tokens are remembered for, 0 checks every request")
+	flags.StringSlice("auth-anonymous-routes", []string{"/"}, "Route patterns that can be requested without a token, like '/api/v1/pods/{name}'")
+	flags.StringSlice("auth-audiences", nil, "Audiences tokens have to be intended for. Defaults to the API server's")
+	flags.String("otlp-endpoint", "", "URL of an OTLP/HTTP collector to export traces to, like http://localhost:4318. Tracing is off when empty")
+
+	v := viper.New()
+	v.SetEnvPrefix("PODLIST")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	return &Loader{v: v, flags: flags}
+}
+
+// Load parses the command line and reads the configuration, returning an
+// error if any of it is invalid
+func (l *Loader) Load(args []string) (Config, error) {
+	l.flags.Parse(args)
+	l.v.BindPFlags(l.flags)
+
+	if path := l.v.GetString("config"); path != "" {
+		l.v.SetConfigFile(path)
+		l.v.SetConfigType("yaml")
+		if err := l.v.ReadInConfig(); err != nil {
+			return Config{}, fmt.Errorf("failed to read configuration file: %w", err)
+		}
+	}
+
+	c, err := l.unmarshal()
+	if err != nil {
+		return Config{}, err
+	}
+	l.loaded = c
+	return c, nil
+}
+
+func (l *Loader) unmarshal() (Config, error) {
+	var c Config
+	if err := l.v.Unmarshal(&c); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return c, c.Validate()
+}
+
+// Watch calls apply with the new configuration every time the file changes.
+// Invalid changes are logged and ignored. Settings that can't be applied live
+// are logged as needing a restart, apply should only act on the live ones.
+// Watch does nothing when there's no configuration file.
+func (l *Loader) Watch(log zerolog.Logger, apply func(Config)) {
+	if l.v.ConfigFileUsed() == "" {
+		return
+	}
+
+	l.v.OnConfigChange(func(e fsnotify.Event) {
+		c, err := l.unmarshal()
+		if err != nil {
+			log.Error().Err(err).Str("file", e.Name).Msg("Ignoring configuration change")
+			return
+		}
+
+		if restart := l.loaded.restartRequired(c); len(restart) > 0 {
+			log.Warn().Strs("keys", restart).Msg("Configuration changes that need a restart to take effect")
+		}
+		apply(c)
+		log.Info().Str("file", e.Name).Msg("Reloaded configuration")
+	})
+	l.v.WatchConfig()
+}
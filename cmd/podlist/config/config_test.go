@@ -0,0 +1,216 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/abatilo/okteto-exercise/cmd/podlist/server"
+)
+
+func writeConfig(t *testing.T, path, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podlist.yaml")
+	writeConfig(t, path, `
+addr: ":9000"
+admin-addr: ":9001"
+namespaces: [default, staging]
+age-format: kubectl
+default-sort: -restarts
+`)
+	t.Setenv("PODLIST_ADMIN_ADDR", ":9002")
+	t.Setenv("PODLIST_AGE_FORMAT", "long")
+	t.Setenv("PODLIST_POD_METRICS_LIMIT", "50")
+
+	c, err := NewLoader("podlist").Load([]string{"--config", path, "--admin-addr", ":9003", "--age-units", "3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Config{
+		// From the file
+		Addr:        ":9000",
+		Namespaces:  []string{"default", "staging"},
+		DefaultSort: "-restarts",
+		// The environment overrides the file
+		AgeFormat:       "long",
+		PodMetricsLimit: 50,
+		// Flags override the environment
+		AdminAddr: ":9003",
+		AgeUnits:  3,
+		// Defaults
+		ShutdownTimeout:     server.DefaultShutdownTimeout,
+		AuthCacheTTL:        time.Minute,
+		AuthAnonymousRoutes: []string{"/"},
+		AuthAudiences:       []string{},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+}
+
+func Test_LoadEnvironmentNamespaces(t *testing.T) {
+	t.Setenv("PODLIST_NAMESPACES", "default,staging")
+
+	c, err := NewLoader("podlist").Load(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"default", "staging"}; !reflect.DeepEqual(c.Namespaces, expected) {
+		t.Errorf("expected namespaces %v, got %v", expected, c.Namespaces)
+	}
+}
+
+func Test_LoadMissingFile(t *testing.T) {
+	_, err := NewLoader("podlist").Load([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml")})
+	if err == nil || !strings.Contains(err.Error(), "failed to read configuration file") {
+		t.Errorf("expected the missing file to be reported, got %v", err)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	valid := Config{
+		Addr:            ":8080",
+		AdminAddr:       ":8081",
+		ShutdownTimeout: time.Second,
+		AgeFormat:       "long",
+		AgeUnits:        2,
+	}
+
+	type test struct {
+		name        string
+		modify      func(c *Config)
+		expectedErr string
+	}
+
+	tests := []test{
+		{name: "valid", modify: func(c *Config) {}},
+		{name: "every namespace", modify: func(c *Config) { c.Namespaces = []string{"*"} }},
+		{
+			name:        "addr",
+			modify:      func(c *Config) { c.Addr = "8080" },
+			expectedErr: `invalid configuration: addr: expected host:port or :port, got "8080"`,
+		},
+		{
+			name:        "same addresses",
+			modify:      func(c *Config) { c.AdminAddr = ":8080" },
+			expectedErr: "invalid configuration: admin-addr: must be different from addr",
+		},
+		{
+			name:        "shutdown timeout",
+			modify:      func(c *Config) { c.ShutdownTimeout = 0 },
+			expectedErr: "invalid configuration: shutdown-timeout: must be greater than 0",
+		},
+		{
+			name:        "every namespace and more",
+			modify:      func(c *Config) { c.Namespaces = []string{"*", "default"} },
+			expectedErr: `invalid configuration: namespaces: "*" can't be combined with other namespaces`,
+		},
+		{
+			name:        "namespace",
+			modify:      func(c *Config) { c.Namespaces = []string{"Not_A_Namespace"} },
+			expectedErr: `invalid configuration: namespaces: "Not_A_Namespace" is not a valid namespace`,
+		},
+		{
+			name:        "default sort",
+			modify:      func(c *Config) { c.DefaultSort = "size" },
+			expectedErr: `invalid configuration: invalid default sort: invalid sort: unknown key "size"`,
+		},
+		{
+			name:        "admin token",
+			modify:      func(c *Config) { c.AdminToken = "hunter2" },
+			expectedErr: "invalid configuration: admin-token: must be at least 16 characters",
+		},
+		{name: "auth", modify: func(c *Config) { c.AuthAnonymousRoutes = []string{"/", "/api/v1/pods/{name}"} }},
+		{
+			name:        "auth cache ttl",
+			modify:      func(c *Config) { c.AuthCacheTTL = -time.Second },
+			expectedErr: "invalid configuration: auth-cache-ttl: can't be negative",
+		},
+		{
+			name:        "anonymous route",
+			modify:      func(c *Config) { c.AuthAnonymousRoutes = []string{"api/v1/pods"} },
+			expectedErr: `invalid configuration: auth-anonymous-routes: "api/v1/pods" is not a route pattern`,
+		},
+		{
+			name: "everything at once",
+			modify: func(c *Config) {
+				c.Addr = ""
+				c.AgeUnits = 0
+				c.PodMetricsLimit = -1
+			},
+			expectedErr: `invalid configuration: addr: expected host:port or :port, got ""; invalid age units: must be at least 1; pod-metrics-limit: can't be negative`,
+		},
+	}
+
+	for _, test := range tests {
+		c := valid
+		test.modify(&c)
+		err := c.Validate()
+		if test.expectedErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.expectedErr) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.expectedErr, err)
+		}
+	}
+}
+
+func Test_restartRequired(t *testing.T) {
+	loaded := Config{Addr: ":8080", Namespaces: []string{"default"}, AgeFormat: "long", Debug: false}
+	changed := Config{Addr: ":9090", Namespaces: []string{"default", "staging"}, AgeFormat: "kubectl", Debug: true}
+
+	if keys := loaded.restartRequired(changed); !reflect.DeepEqual(keys, []string{"addr", "namespaces"}) {
+		t.Errorf("expected addr and namespaces to need a restart, got %v", keys)
+	}
+	if keys := loaded.restartRequired(loaded); keys != nil {
+		t.Errorf("expected nothing to need a restart, got %v", keys)
+	}
+}
+
+func Test_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podlist.yaml")
+	writeConfig(t, path, "age-format: long\n")
+
+	loader := NewLoader("podlist")
+	if _, err := loader.Load([]string{"--config", path}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	applied := make(chan Config, 10)
+	loader.Watch(zerolog.Nop(), func(c Config) {
+		applied <- c
+	})
+
+	// An invalid change is ignored, then a valid one is applied
+	writeConfig(t, path, "age-format: short\n")
+	time.Sleep(100 * time.Millisecond)
+	writeConfig(t, path, "age-format: kubectl\ndefault-sort: -age\n")
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case c := <-applied:
+			if c.AgeFormat == "short" {
+				t.Fatalf("expected the invalid change to be ignored")
+			}
+			if c.AgeFormat == "kubectl" && c.DefaultSort == "-age" {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("the change was never applied")
+		}
+	}
+}
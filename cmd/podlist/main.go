@@ -6,37 +6,83 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/abatilo/okteto-exercise/cmd/podlist/config"
 	"github.com/abatilo/okteto-exercise/cmd/podlist/server"
 	"github.com/abatilo/okteto-exercise/internal"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
-	"github.com/spf13/pflag"
-	"github.com/spf13/viper"
 )
 
 func main() {
-	flagSet := pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
-	flagSet.Bool("debug", false, "Enable debug logging")
-	flagSet.Parse(os.Args[1:])
+	// Everything is logged at info until the configuration says otherwise
+	logLevels := internal.NewLogLevel(zerolog.InfoLevel)
+	log := logLevels.Logger(os.Stdout).With().Timestamp().Logger()
 
-	viper.BindPFlags(flagSet)
-	viper.SetEnvPrefix("PODLIST")
-	viper.AutomaticEnv()
+	loader := config.NewLoader(os.Args[0])
+	cfg, err := loader.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	logLevels.SetDefault(logLevel(cfg.Debug))
+
+	metrics := &internal.PrometheusMetrics{}
 
-	if viper.GetBool("debug") {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	} else {
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	tracerProvider := internal.NewNoopTracerProvider()
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.OTLPEndpoint != "" {
+		tp, err := internal.NewOTLPTracerProvider(context.Background(), cfg.OTLPEndpoint)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up tracing")
+		}
+		tracerProvider, shutdownTracing = tp, tp.Shutdown
+		log.Info().Str("endpoint", cfg.OTLPEndpoint).Msg("Exporting traces")
 	}
 
-	log := zerolog.New(os.Stdout).With().Timestamp().Logger()
-	k8sClient := internal.NewKubernetesClient(log)
-	s := server.NewServer(
-		server.WithLogger(log),
-		server.WithAdminServer(server.DefaultAdminServer(k8sClient)),
-		server.WithMetrics(&internal.PrometheusMetrics{}),
-		server.WithKubernetesClient(k8sClient),
+	k8sClient, err := internal.NewKubernetesClient(
+		log,
+		internal.WithKubeconfig(cfg.Kubeconfig),
+		internal.WithKubeContext(cfg.Context),
+		internal.WithNamespaces(cfg.Namespaces),
+		internal.WithMetrics(metrics),
 	)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create Kubernetes client")
+	}
+
+	// Populate the pod cache in the background, requests fall back to the API
+	// server until it has synced
+	stopInformers := make(chan struct{})
+	k8sClient.Start(stopInformers)
+	tracedClient := internal.NewTracedClient(k8sClient, tracerProvider)
+
+	options := []server.ServerOption{
+		server.WithLogger(log),
+		server.WithAddr(cfg.Addr),
+		server.WithShutdownTimeout(cfg.ShutdownTimeout),
+		server.WithAdminServer(server.DefaultAdminServer(cfg.AdminAddr, tracedClient, cfg.PodMetricsLimit, prometheus.DefaultRegisterer, prometheus.DefaultGatherer)),
+		server.WithMetrics(metrics),
+		server.WithKubernetesClient(tracedClient),
+		server.WithTracerProvider(tracerProvider),
+		server.WithSettings(cfg.Settings()),
+		server.WithLogLevel(logLevels),
+		server.WithAdminToken(cfg.AdminToken),
+	}
+	if cfg.Auth {
+		var reviewer internal.TokenReviewer = k8sClient.TokenReviewer(cfg.AuthAudiences)
+		if cfg.AuthCacheTTL > 0 {
+			reviewer = internal.NewCachedTokenReviewer(reviewer, cfg.AuthCacheTTL, internal.RealClock{})
+		}
+		options = append(options, server.WithAuthentication(reviewer, cfg.AuthAnonymousRoutes...))
+		log.Info().Strs("anonymousRoutes", cfg.AuthAnonymousRoutes).Msg("Authenticating requests")
+	}
+	s := server.NewServer(options...)
+
+	loader.Watch(log, func(cfg config.Config) {
+		logLevels.SetDefault(logLevel(cfg.Debug))
+		s.UpdateSettings(cfg.Settings())
+	})
 
 	// Register signal handlers for graceful shutdown
 	done := make(chan struct{})
@@ -45,14 +91,30 @@ func main() {
 	go func() {
 		<-quit
 		log.Info().Msg("Shutting down gracefully")
-		s.Shutdown(context.TODO())
+		if err := s.Shutdown(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Requests didn't finish before the shutdown timeout")
+		}
+		close(stopInformers)
 		close(done)
 	}()
 
-	log.Info().Msg("Listening on port 8080")
 	if err := s.Start(); err != http.ErrServerClosed {
-		log.Error().Err(err).Msg("couldn't shut down gracefully")
+		log.Fatal().Err(err).Msg("Server failed")
 	}
 	<-done
+
+	// Flush the spans of the last requests
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("couldn't flush traces")
+	}
 	log.Info().Msg("Exiting")
 }
+
+func logLevel(debug bool) zerolog.Level {
+	if debug {
+		return zerolog.DebugLevel
+	}
+	return zerolog.InfoLevel
+}
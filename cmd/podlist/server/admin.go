@@ -1,38 +1,28 @@
 package server
 
 import (
-	"context"
-	"fmt"
 	"net/http"
 	"net/http/pprof"
-	"time"
 
-	"github.com/AppsFlyer/go-sundheit"
-	"github.com/AppsFlyer/go-sundheit/checks"
-	healthhttp "github.com/AppsFlyer/go-sundheit/http"
 	"github.com/abatilo/okteto-exercise/internal"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func DefaultAdminServer(kubernetesClient internal.ControlPlaneClient) *http.Server {
-	h := gosundheit.New()
-
-	h.RegisterCheck(
-		&checks.CustomCheck{
-			CheckName: "k8s-controlplane-healthz",
-			CheckFunc: func(ctx context.Context) (details interface{}, err error) {
-				result := kubernetesClient.Healthz(ctx)
-				b, _ := result.Raw()
-				return string(b), result.Error()
-			},
-		},
-		gosundheit.ExecutionPeriod(5*time.Second),
-		gosundheit.ExecutionTimeout(time.Second),
-	)
+// DefaultAdminServer serves the liveness, readiness and startup probes,
+// metrics and pprof on addr. Metrics about the cached pods are collected at
+// scrape time, with per pod series for up to podMetricsLimit pods, and
+// registered to registerer. /metrics serves what gatherer collects, which for
+// prometheus.DefaultRegisterer is prometheus.DefaultGatherer. A registerer can
+// only be given to one admin server. It's served by passing it to
+// WithAdminServer.
+func DefaultAdminServer(addr string, kubernetesClient internal.ControlPlaneClient, podMetricsLimit int, registerer prometheus.Registerer, gatherer prometheus.Gatherer) *http.Server {
+	registerer.MustRegister(internal.NewPodCollector(kubernetesClient, internal.RealClock{}, podMetricsLimit))
 
 	mux := http.NewServeMux()
-	mux.Handle("/healthz", healthhttp.HandleHealthJSON(h))
-	mux.Handle("/metrics", promhttp.Handler())
+	healthChecks := NewHealthChecks(kubernetesClient)
+	healthChecks.Register(mux)
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(registerer, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})))
 
 	// pprof
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
@@ -42,10 +32,9 @@ func DefaultAdminServer(kubernetesClient internal.ControlPlaneClient) *http.Serv
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
 	adminSrv := &http.Server{
-		Addr:    fmt.Sprintf(":8081"),
+		Addr:    addr,
 		Handler: mux,
 	}
-
-	go adminSrv.ListenAndServe()
+	adminSrv.RegisterOnShutdown(healthChecks.Stop)
 	return adminSrv
 }
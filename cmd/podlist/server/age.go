@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hako/durafmt"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// AgeFormat is how the age column is written for people
+type AgeFormat string
+
+const (
+	// AgeFormatKubectl writes ages the way kubectl does, like 3d4h or 45m
+	AgeFormatKubectl AgeFormat = "kubectl"
+
+	// AgeFormatLong spells out the largest units, like "3 days 4 hours"
+	AgeFormatLong AgeFormat = "long"
+)
+
+// DefaultAgeUnits is how many units the long age format writes by default
+const DefaultAgeUnits = 2
+
+// ParseAgeFormat validates an age format name
+func ParseAgeFormat(name string) (AgeFormat, error) {
+	switch format := AgeFormat(name); format {
+	case AgeFormatKubectl, AgeFormatLong:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid age format %q, expected %q or %q", name, AgeFormatKubectl, AgeFormatLong)
+}
+
+// humanizeAge formats an age. units limits how many units the long format
+// writes, kubectl decides its own precision based on how old a pod is.
+func humanizeAge(age time.Duration, format AgeFormat, units int) string {
+	if format == AgeFormatKubectl {
+		return duration.HumanDuration(age)
+	}
+	if units < 1 {
+		units = DefaultAgeUnits
+	}
+	return durafmt.Parse(age).LimitFirstN(units).String()
+}
+
+// rfc3339 drops unset timestamps from the response
+func rfc3339(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/abatilo/okteto-exercise/internal"
+)
+
+// authenticateHeader is sent with every 401 so clients know to send a bearer
+// token
+const authenticateHeader = `Bearer realm="podlist"`
+
+type userContextKey struct{}
+
+// UserFromContext returns the user that made the request, ok is false for
+// anonymous requests and when authentication is off
+func UserFromContext(ctx context.Context) (user internal.UserInfo, ok bool) {
+	user, ok = ctx.Value(userContextKey{}).(internal.UserInfo)
+	return user, ok
+}
+
+// authenticate checks the request's bearer token with the token reviewer,
+// puts the user on the request's context and adds them to its logs. Routes in
+// anonymousRoutes can be requested without a token, but a token that is sent
+// is always checked. Without a token reviewer every request is let through.
+func (s *Server) authenticate(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.tokenReviewer == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := bearerToken(r)
+			if !ok {
+				if s.anonymousRoutes[matchRoute(routes, r)] {
+					next.ServeHTTP(w, r)
+					return
+				}
+				unauthorized(w, r, "a bearer token is required")
+				return
+			}
+
+			user, err := s.tokenReviewer.ReviewToken(r.Context(), token)
+			if errors.Is(err, internal.ErrTokenRejected) {
+				zerolog.Ctx(r.Context()).Debug().Err(err).Msg("Rejected token")
+				unauthorized(w, r, "the bearer token is not valid")
+				return
+			}
+			if err != nil {
+				zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to authenticate request")
+				writeProblem(w, r, newProblem(http.StatusServiceUnavailable, problemAuthenticationUnavailable, "the token could not be checked, try again later"))
+				return
+			}
+
+			zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("user", user.Username)
+			})
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.EnduserIDKey.String(user.Username))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+		})
+	}
+}
+
+// bearerToken returns the token from the Authorization header, ok is false
+// when there isn't one
+func bearerToken(r *http.Request) (token string, ok bool) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", authenticateHeader)
+	writeProblem(w, r, newProblem(http.StatusUnauthorized, problemUnauthorized, detail))
+}
+
+// warnUnknownAnonymousRoutes logs anonymous routes that don't match any
+// route pattern, which are most likely a typo
+func (s *Server) warnUnknownAnonymousRoutes(routes chi.Routes) {
+	known := map[string]bool{}
+	chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		known[route] = true
+		return nil
+	})
+	for route := range s.anonymousRoutes {
+		if !known[route] {
+			s.log.Warn().Str("route", route).Msg("Anonymous route doesn't match any route")
+		}
+	}
+}
+
+// WithAuthentication requires requests to send a bearer token that reviewer
+// accepts, except for the route patterns in anonymousRoutes, like
+// "/api/v1/pods/{name}"
+func WithAuthentication(reviewer internal.TokenReviewer, anonymousRoutes ...string) ServerOption {
+	return func(s *Server) {
+		s.tokenReviewer = reviewer
+		s.anonymousRoutes = map[string]bool{}
+		for _, route := range anonymousRoutes {
+			s.anonymousRoutes[route] = true
+		}
+	}
+}
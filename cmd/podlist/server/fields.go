@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// podColumn is a field of the pod list clients can select with the fields
+// query parameter
+type podColumn struct {
+	field  string
+	header string
+	value  func(p pod) interface{}
+}
+
+// text is the column's value in the CSV and table formats
+func (c podColumn) text(p pod) string {
+	switch v := c.value(p).(type) {
+	case string:
+		return v
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []string:
+		return strings.Join(v, ",")
+	case map[string]string:
+		pairs := make([]string, 0, len(v))
+		for key, value := range v {
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return ""
+}
+
+var podFields = []podColumn{
+	{field: "namespace", header: "NAMESPACE", value: func(p pod) interface{} { return p.Namespace }},
+	{field: "name", header: "NAME", value: func(p pod) interface{} { return p.Name }},
+	{field: "ready", header: "READY", value: func(p pod) interface{} { return p.Ready }},
+	{field: "status", header: "STATUS", value: func(p pod) interface{} { return p.Status }},
+	{field: "restarts", header: "RESTARTS", value: func(p pod) interface{} { return p.Restarts }},
+	{field: "age", header: "AGE", value: func(p pod) interface{} { return p.Age }},
+	{field: "ageSeconds", header: "AGE SECONDS", value: func(p pod) interface{} { return p.AgeSeconds }},
+	{field: "creationTimestamp", header: "CREATED", value: func(p pod) interface{} { return optional(p.CreationTimestamp) }},
+	{field: "podIP", header: "IP", value: func(p pod) interface{} { return p.podIP }},
+	{field: "node", header: "NODE", value: func(p pod) interface{} { return p.node }},
+	{field: "qosClass", header: "QOS CLASS", value: func(p pod) interface{} { return p.qosClass }},
+	{field: "owner", header: "OWNER", value: func(p pod) interface{} { return p.owner }},
+	{field: "phase", header: "PHASE", value: func(p pod) interface{} { return p.phase }},
+	{field: "startTime", header: "START TIME", value: func(p pod) interface{} { return optional(p.StartTime) }},
+	{field: "images", header: "IMAGES", value: func(p pod) interface{} { return nonNilStrings(p.images) }},
+	{field: "labels", header: "LABELS", value: func(p pod) interface{} { return nonNilMap(p.labels) }},
+	{field: "annotations", header: "ANNOTATIONS", value: func(p pod) interface{} { return nonNilMap(p.annotations) }},
+}
+
+// podFieldPresets expand to a list of fields
+var podFieldPresets = map[string][]string{
+	"default": {"namespace", "name", "ready", "status", "restarts", "age", "ageSeconds", "creationTimestamp", "startTime"},
+	"wide":    {"namespace", "name", "ready", "status", "restarts", "age", "ageSeconds", "creationTimestamp", "startTime", "podIP", "node", "owner", "images"},
+}
+
+// parseFields turns the fields query parameter into the columns to return. It
+// takes a comma separated list of fields and presets, duplicates are only
+// returned once. defaultFields is used when the parameter is empty.
+func parseFields(fieldsParam, defaultFields string) ([]podColumn, error) {
+	if fieldsParam == "" {
+		fieldsParam = defaultFields
+	}
+
+	var names []string
+	for _, name := range strings.Split(fieldsParam, ",") {
+		name = strings.TrimSpace(name)
+		if preset, ok := podFieldPresets[name]; ok {
+			names = append(names, preset...)
+			continue
+		}
+		names = append(names, name)
+	}
+
+	var columns []podColumn
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		column, ok := podFieldByName(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid fields: unknown field %q", name)
+		}
+		seen[name] = true
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func podFieldByName(name string) (podColumn, bool) {
+	for _, column := range podFields {
+		if column.field == name {
+			return column, true
+		}
+	}
+	return podColumn{}, false
+}
+
+// optional makes unset values null rather than empty strings
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// projectedPod is a pod limited to the requested columns, its JSON keeps the
+// order they were asked for in
+type projectedPod struct {
+	pod     pod
+	columns []podColumn
+}
+
+func (p projectedPod) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range p.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(column.field)
+		value, err := json.Marshal(column.value(p.pod))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog"
+	"sigs.k8s.io/yaml"
+)
+
+// podListFormat is a representation of the pod list a client can ask for
+type podListFormat struct {
+	contentType string
+	render      func(w http.ResponseWriter, r *http.Request, resp podListResponse)
+
+	// defaultFields are returned when the client doesn't pass any
+	defaultFields string
+}
+
+var podListFormats = map[string]podListFormat{
+	"json": {
+		contentType: "application/json",
+		render: func(w http.ResponseWriter, r *http.Request, resp podListResponse) {
+			render.JSON(w, r, resp)
+		},
+		defaultFields: "default",
+	},
+	"yaml": {
+		contentType:   "application/yaml",
+		render:        renderPodsYAML,
+		defaultFields: "default",
+	},
+	"csv": {
+		contentType:   "text/csv",
+		render:        renderPodsCSV,
+		defaultFields: "default",
+	},
+	"ndjson": {
+		contentType:   "application/x-ndjson",
+		render:        renderPodsNDJSON,
+		defaultFields: "default",
+	},
+	"table": {
+		contentType: "text/plain",
+		render:      renderPodsTable,
+		// The same columns as `kubectl get pods`
+		defaultFields: "namespace,name,ready,status,restarts,age",
+	},
+}
+
+// negotiatePodListFormat picks a format from the format query parameter, or
+// failing that the Accept header. JSON is the default.
+func negotiatePodListFormat(r *http.Request) (podListFormat, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		format, ok := podListFormats[name]
+		if !ok {
+			return podListFormat{}, fmt.Errorf("invalid format: unknown format %q", name)
+		}
+		return format, nil
+	}
+
+	type acceptedType struct {
+		mediaType string
+		quality   float64
+	}
+
+	var accepted []acceptedType
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		accepted = append(accepted, acceptedType{mediaType: mediaType, quality: quality})
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+
+	for _, a := range accepted {
+		for _, format := range podListFormats {
+			if a.quality > 0 && a.mediaType == format.contentType {
+				return format, nil
+			}
+		}
+	}
+	return podListFormats["json"], nil
+}
+
+// setPaginationHeaders exposes the pagination envelope for formats that can
+// only hold pods
+func setPaginationHeaders(w http.ResponseWriter, resp podListResponse) {
+	if resp.Continue != "" {
+		w.Header().Set("X-Continue", resp.Continue)
+	}
+	if resp.RemainingItemCount != nil {
+		w.Header().Set("X-Remaining-Item-Count", strconv.FormatInt(*resp.RemainingItemCount, 10))
+	}
+}
+
+func renderPodsYAML(w http.ResponseWriter, r *http.Request, resp podListResponse) {
+	// sigs.k8s.io/yaml goes through encoding/json, so the field names match
+	// the JSON response
+	b, err := yaml.Marshal(resp)
+	if err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("failed to render pods as YAML")
+		writeProblem(w, r, newProblem(http.StatusInternalServerError, problemInternal, ""))
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(b)
+}
+
+func renderPodsCSV(w http.ResponseWriter, r *http.Request, resp podListResponse) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	setPaginationHeaders(w, resp)
+
+	cw := csv.NewWriter(w)
+	record := make([]string, len(resp.columns))
+	for i, column := range resp.columns {
+		record[i] = column.header
+	}
+	cw.Write(record)
+	for _, p := range resp.Pods {
+		for i, column := range resp.columns {
+			record[i] = column.text(p.pod)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+}
+
+func renderPodsNDJSON(w http.ResponseWriter, r *http.Request, resp podListResponse) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	setPaginationHeaders(w, resp)
+
+	enc := json.NewEncoder(w)
+	for _, p := range resp.Pods {
+		enc.Encode(p)
+	}
+}
+
+// renderPodsTable writes the same aligned columns as `kubectl get pods`
+func renderPodsTable(w http.ResponseWriter, r *http.Request, resp podListResponse) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	setPaginationHeaders(w, resp)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	for i, column := range resp.columns {
+		if i > 0 {
+			fmt.Fprint(tw, "\t")
+		}
+		fmt.Fprint(tw, column.header)
+	}
+	fmt.Fprintln(tw)
+	for _, p := range resp.Pods {
+		for i, column := range resp.columns {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			value := column.text(p.pod)
+			if value == "" {
+				value = "<none>"
+			}
+			fmt.Fprint(tw, value)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
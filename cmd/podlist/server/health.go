@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AppsFlyer/go-sundheit"
+	"github.com/AppsFlyer/go-sundheit/checks"
+	"github.com/abatilo/okteto-exercise/internal"
+)
+
+// HealthChecks backs the admin server's probes. Each probe has its own set of
+// checks so that liveness never depends on anything outside of the process:
+// the API server being unreachable should take us out of the Service, not get
+// the pod restarted.
+type HealthChecks struct {
+	live    gosundheit.Health
+	ready   gosundheit.Health
+	startup gosundheit.Health
+}
+
+// NewHealthChecks starts running the checks in the background, Stop ends them
+func NewHealthChecks(kubernetesClient internal.ControlPlaneClient) *HealthChecks {
+	h := &HealthChecks{
+		live:    gosundheit.New(),
+		ready:   gosundheit.New(),
+		startup: gosundheit.New(),
+	}
+
+	// Answering at all is proof enough that the process is alive
+	h.live.RegisterCheck(
+		&checks.CustomCheck{
+			CheckName: "ping",
+			CheckFunc: func(ctx context.Context) (details interface{}, err error) {
+				return "pong", nil
+			},
+		},
+		gosundheit.ExecutionPeriod(5*time.Second),
+		gosundheit.InitiallyPassing(true),
+	)
+
+	cacheSynced := &checks.CustomCheck{
+		CheckName: "k8s-pod-cache-synced",
+		CheckFunc: func(ctx context.Context) (details interface{}, err error) {
+			if !kubernetesClient.CacheSynced() {
+				return "pod cache not synced", errors.New("pod cache not synced")
+			}
+			return "pod cache synced", nil
+		},
+	}
+
+	// Until the cache has synced every list goes to the API server, which is
+	// fine for a while but not what we want to be running on
+	h.startup.RegisterCheck(
+		cacheSynced,
+		gosundheit.ExecutionPeriod(time.Second),
+		gosundheit.ExecutionTimeout(time.Second),
+	)
+
+	h.ready.RegisterCheck(
+		&checks.CustomCheck{
+			CheckName: "k8s-controlplane-healthz",
+			CheckFunc: func(ctx context.Context) (details interface{}, err error) {
+				result := kubernetesClient.Healthz(ctx)
+				b, _ := result.Raw()
+				return string(b), result.Error()
+			},
+		},
+		gosundheit.ExecutionPeriod(5*time.Second),
+		gosundheit.ExecutionTimeout(time.Second),
+	)
+	h.ready.RegisterCheck(
+		cacheSynced,
+		gosundheit.ExecutionPeriod(5*time.Second),
+		gosundheit.ExecutionTimeout(time.Second),
+	)
+	// RBAC rarely changes, there's no need to ask as often
+	h.ready.RegisterCheck(
+		&checks.CustomCheck{
+			CheckName: "k8s-pod-permissions",
+			CheckFunc: func(ctx context.Context) (details interface{}, err error) {
+				if err := kubernetesClient.CheckPermissions(ctx); err != nil {
+					return "missing permissions", err
+				}
+				return "allowed to list and watch pods", nil
+			},
+		},
+		gosundheit.ExecutionPeriod(30*time.Second),
+		gosundheit.ExecutionTimeout(5*time.Second),
+	)
+
+	return h
+}
+
+// Register adds /livez, /readyz and /startupz to the mux
+func (h *HealthChecks) Register(mux *http.ServeMux) {
+	mux.Handle("/livez", healthHandler("livez", h.live))
+	mux.Handle("/readyz", healthHandler("readyz", h.ready))
+	mux.Handle("/startupz", healthHandler("startupz", h.startup))
+}
+
+// Stop ends every check
+func (h *HealthChecks) Stop() {
+	h.live.DeregisterAll()
+	h.ready.DeregisterAll()
+	h.startup.DeregisterAll()
+}
+
+// healthHandler reports the latest results of the checks in the same format
+// as the Kubernetes API server's own probes. A healthy probe is just "ok"
+// unless ?verbose asks for every check, a failing one always lists them.
+func healthHandler(name string, h gosundheit.Health) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		results, healthy := h.Results()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		_, verbose := r.URL.Query()["verbose"]
+		if healthy && !verbose {
+			fmt.Fprint(w, "ok")
+			return
+		}
+
+		checkNames := make([]string, 0, len(results))
+		for checkName := range results {
+			checkNames = append(checkNames, checkName)
+		}
+		sort.Strings(checkNames)
+
+		var b strings.Builder
+		for _, checkName := range checkNames {
+			if result := results[checkName]; result.IsHealthy() {
+				fmt.Fprintf(&b, "[+]%s ok\n", checkName)
+			} else {
+				fmt.Fprintf(&b, "[-]%s failed: %v\n", checkName, result.Error)
+			}
+		}
+		if healthy {
+			fmt.Fprintf(&b, "%s check passed\n", name)
+		} else {
+			fmt.Fprintf(&b, "%s check failed\n", name)
+		}
+		fmt.Fprint(w, b.String())
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// debugTokenHeader asks for a single request to be logged at debug level. Its
+// value has to be the admin token.
+const debugTokenHeader = "X-Debug-Token"
+
+type logLevelResponse struct {
+	Level    string `json:"level"`
+	Default  string `json:"default"`
+	RevertAt string `json:"revertAt,omitempty"`
+}
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+	// RevertAfter is a duration like "15m", after which the level goes back
+	// to the default
+	RevertAfter string `json:"revertAfter,omitempty"`
+}
+
+// logLevel reports the log level on GET and changes it on PUT. Changing it
+// needs the admin token when one is configured.
+func (s *Server) logLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			if !s.adminAuthorized(r) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="podlist-admin"`)
+				writeProblem(w, r, newProblem(http.StatusUnauthorized, problemUnauthorized, "changing the log level needs the admin token"))
+				return
+			}
+
+			var req logLevelRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeProblem(w, r, invalidParameter(fmt.Errorf("invalid body: %w", err)))
+				return
+			}
+			level, err := zerolog.ParseLevel(req.Level)
+			if err != nil || level == zerolog.NoLevel {
+				writeProblem(w, r, invalidParameter(fmt.Errorf("invalid level %q", req.Level)))
+				return
+			}
+			var revertAfter time.Duration
+			if req.RevertAfter != "" {
+				revertAfter, err = time.ParseDuration(req.RevertAfter)
+				if err != nil || revertAfter <= 0 {
+					writeProblem(w, r, invalidParameter(fmt.Errorf("invalid revertAfter %q: expected a positive duration like 15m", req.RevertAfter)))
+					return
+				}
+			}
+
+			s.logLevels.Set(level, revertAfter)
+			s.log.WithLevel(zerolog.NoLevel).
+				Str("level", level.String()).
+				Dur("revertAfter", revertAfter).
+				Msg("Log level changed")
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeProblem(w, r, newProblem(http.StatusMethodNotAllowed, problemMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", r.Method, r.URL.Path)))
+			return
+		}
+
+		level, defaultLevel, revertAt := s.logLevels.Level()
+		resp := logLevelResponse{Level: level.String(), Default: defaultLevel.String()}
+		if !revertAt.IsZero() {
+			resp.RevertAt = revertAt.UTC().Format(time.RFC3339)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// adminAuthorized checks for the admin token as a bearer token. Without an
+// admin token configured the admin server is trusted to not be exposed, the
+// same as pprof.
+func (s *Server) adminAuthorized(r *http.Request) bool {
+	if s.adminToken == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return s.isAdminToken(token)
+}
+
+func (s *Server) isAdminToken(token string) bool {
+	return s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// debugRequests logs a request at debug level, whatever the current level, when
+// it passes the admin token in the X-Debug-Token header. Requests with any
+// other token are refused rather than served without the debug logs they asked
+// for.
+func (s *Server) debugRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(debugTokenHeader)
+		if token == "" || s.logLevels == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !s.isAdminToken(token) {
+			writeProblem(w, r, newProblem(http.StatusUnauthorized, problemUnauthorized, "the debug token is not valid"))
+			return
+		}
+
+		// Without the sampler the current level doesn't apply
+		log := zerolog.Ctx(r.Context()).Sample(nil).Level(zerolog.DebugLevel).
+			With().Bool("debugRequest", true).Logger()
+		log.Debug().Msg("Debug logging requested")
+		next.ServeHTTP(w, r.WithContext(log.WithContext(r.Context())))
+	})
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/abatilo/okteto-exercise/internal"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader carries the request ID in both directions. A client or proxy
+// that already has an ID for the request can pass it along, otherwise
+// middleware.RequestID generates one.
+const requestIDHeader = "X-Request-ID"
+
+// echoRequestID returns the request ID to the client so it can be quoted when
+// reporting a problem
+func echoRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// nameSpan names the request's span after its route pattern, like
+// "GET /api/v1/pods/{name}", rather than the path
+func nameSpan(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := matchRoute(routes, r)
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRouteKey.String(route))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// accessLog puts a logger tagged with the request and trace IDs on the
+// request's context, handlers get it with zerolog.Ctx, and logs a line for
+// every request once it has been served
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logContext := s.log.With().Str("requestId", middleware.GetReqID(r.Context()))
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logContext = logContext.Str("traceId", sc.TraceID().String()).Str("spanId", sc.SpanID().String())
+		}
+		log := logContext.Logger()
+		ctx := log.WithContext(r.Context())
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			// Nothing was written, which net/http turns into a 200
+			status = http.StatusOK
+		}
+
+		// The pattern keeps paths like /api/v1/pods/{name} from having a
+		// different value for every pod
+		route := r.URL.Path
+		if pattern := chi.RouteContext(r.Context()).RoutePattern(); pattern != "" {
+			route = pattern
+		}
+
+		// Middleware further down can add to the logger on the context, like
+		// the user that made the request
+		zerolog.Ctx(ctx).Info().
+			Str("method", r.Method).
+			Str("route", route).
+			Int("status", status).
+			Int("bytes", ww.BytesWritten()).
+			Dur("duration", time.Since(start)).
+			Str("remoteAddr", r.RemoteAddr).
+			Msg("request")
+	})
+}
+
+// unmatchedRoute labels requests that didn't match any route, so that
+// scanners requesting random paths can't create new series
+const unmatchedRoute = "unmatched"
+
+// matchRoute finds the pattern of the route that will serve the request,
+// before the router has run
+func matchRoute(routes chi.Routes, r *http.Request) string {
+	if rctx := chi.NewRouteContext(); routes.Match(rctx, r.Method, r.URL.Path) {
+		return rctx.RoutePattern()
+	}
+	return unmatchedRoute
+}
+
+// standardMethods are the methods requests are labeled with, any other
+// method is labeled "other" so clients can't create new series with made up
+// ones
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+func methodLabel(method string) string {
+	if standardMethods[method] {
+		return method
+	}
+	return "other"
+}
+
+// instrumentRequests records the number, latency and concurrency of requests
+// by route pattern. routes is the router the middleware is used on, it's
+// matched up front so the in-flight gauge knows which route is being served.
+func (s *Server) instrumentRequests(routes chi.Routes) func(http.Handler) http.Handler {
+	requests := s.metrics.NewCounterVec(internal.CounterOpts{
+		Name: "podlist_http_requests_total",
+		Help: "Number of HTTP requests served",
+	}, []string{"method", "route", "status"})
+	duration := s.metrics.NewHistogramVec(internal.HistogramOpts{
+		Name:    "podlist_http_request_duration_seconds",
+		Help:    "How long it took to serve HTTP requests, streams are counted until they're closed",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	inFlight := s.metrics.NewGaugeVec(internal.GaugeOpts{
+		Name: "podlist_http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served",
+	}, []string{"method", "route"})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			method := methodLabel(r.Method)
+			route := matchRoute(routes, r)
+
+			inFlight.WithLabelValues(method, route).Inc()
+			defer inFlight.WithLabelValues(method, route).Dec()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			labels := []string{method, route, strconv.Itoa(status)}
+			requests.WithLabelValues(labels...).Inc()
+			duration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// recoverPanics turns a panicking handler into a 500 rather than a dropped
+// connection
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// Handlers abort on purpose with this one
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			zerolog.Ctx(r.Context()).Error().
+				Interface("panic", rec).
+				Bytes("stack", debug.Stack()).
+				Msg("handler panicked")
+			writeProblem(w, r, newProblem(http.StatusInternalServerError, problemInternal, ""))
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abatilo/okteto-exercise/internal"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// podDetail is everything the pod list summarizes, broken down per container
+type podDetail struct {
+	pod
+	Phase          string            `json:"phase"`
+	Node           string            `json:"node,omitempty"`
+	PodIP          string            `json:"podIP,omitempty"`
+	Conditions     []podCondition    `json:"conditions"`
+	InitContainers []containerDetail `json:"initContainers"`
+	Containers     []containerDetail `json:"containers"`
+}
+
+type podCondition struct {
+	Type               string     `json:"type"`
+	Status             string     `json:"status"`
+	Reason             string     `json:"reason,omitempty"`
+	Message            string     `json:"message,omitempty"`
+	LastTransitionTime *time.Time `json:"lastTransitionTime,omitempty"`
+}
+
+type containerDetail struct {
+	Name            string          `json:"name"`
+	Image           string          `json:"image"`
+	Ready           bool            `json:"ready"`
+	RestartCount    int32           `json:"restartCount"`
+	State           containerState  `json:"state"`
+	LastTermination *containerState `json:"lastTermination,omitempty"`
+}
+
+// containerState flattens the Kubernetes waiting/running/terminated union
+type containerState struct {
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	Message    string     `json:"message,omitempty"`
+	ExitCode   *int32     `json:"exitCode,omitempty"`
+	Signal     int32      `json:"signal,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (s *Server) newPodDetail(p *internal.Pod) podDetail {
+	d := podDetail{
+		pod:            s.newPod(p),
+		Phase:          string(p.Status.Phase),
+		Node:           p.Spec.NodeName,
+		PodIP:          p.Status.PodIP,
+		Conditions:     []podCondition{},
+		InitContainers: newContainerDetails(p.Spec.InitContainers, p.Status.InitContainerStatuses),
+		Containers:     newContainerDetails(p.Spec.Containers, p.Status.ContainerStatuses),
+	}
+
+	for _, c := range p.Status.Conditions {
+		d.Conditions = append(d.Conditions, podCondition{
+			Type:               string(c.Type),
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: timePtr(c.LastTransitionTime.Time),
+		})
+	}
+
+	return d
+}
+
+// newContainerDetails pairs each container in the spec with its status, a
+// container that hasn't been created yet has no status
+func newContainerDetails(containers []internal.Container, statuses []internal.ContainerStatuses) []containerDetail {
+	details := make([]containerDetail, len(containers))
+	for i, c := range containers {
+		details[i] = containerDetail{
+			Name:  c.Name,
+			Image: c.Image,
+			State: containerState{Status: "waiting"},
+		}
+
+		for _, cs := range statuses {
+			if cs.Name != c.Name {
+				continue
+			}
+			details[i].Ready = cs.Ready
+			details[i].RestartCount = cs.RestartCount
+			details[i].State = newContainerState(cs.State)
+			if cs.LastTerminationState.Terminated != nil {
+				lastTermination := newContainerState(cs.LastTerminationState)
+				details[i].LastTermination = &lastTermination
+			}
+		}
+	}
+	return details
+}
+
+func newContainerState(s internal.ContainerState) containerState {
+	switch {
+	case s.Terminated != nil:
+		exitCode := s.Terminated.ExitCode
+		return containerState{
+			Status:     "terminated",
+			Reason:     s.Terminated.Reason,
+			Message:    s.Terminated.Message,
+			ExitCode:   &exitCode,
+			Signal:     s.Terminated.Signal,
+			StartedAt:  timePtr(s.Terminated.StartedAt.Time),
+			FinishedAt: timePtr(s.Terminated.FinishedAt.Time),
+		}
+	case s.Running != nil:
+		return containerState{
+			Status:    "running",
+			StartedAt: timePtr(s.Running.StartedAt.Time),
+		}
+	case s.Waiting != nil:
+		return containerState{
+			Status:  "waiting",
+			Reason:  s.Waiting.Reason,
+			Message: s.Waiting.Message,
+		}
+	}
+	return containerState{Status: "waiting"}
+}
+
+// timePtr drops unset timestamps from the response
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (s *Server) getPod() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+
+		opts, err := podListOptions(r.URL.Query())
+		if err != nil {
+			writeProblem(w, r, invalidParameter(err))
+			return
+		}
+		// A fieldSelector the client sent narrows the lookup further, like
+		// any other filter
+		if opts.FieldSelector != nil {
+			opts.FieldSelector = fields.AndSelectors(internal.PodNameSelector(name), opts.FieldSelector)
+		} else {
+			opts.FieldSelector = internal.PodNameSelector(name)
+		}
+
+		podList, err := s.kubernetesClient.ListPods(r.Context(), opts)
+		if errors.Is(err, internal.ErrNamespaceNotAllowed) {
+			writeProblem(w, r, namespaceForbidden(opts.Namespace))
+			return
+		}
+		if err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Str("pod", name).Msg("failed to get pod")
+			writeProblem(w, r, kubernetesProblem(err))
+			return
+		}
+
+		switch len(podList.Items) {
+		case 0:
+			writeProblem(w, r, newProblem(http.StatusNotFound, problemNotFound, fmt.Sprintf("pod %q not found", name)))
+		case 1:
+			render.JSON(w, r, s.newPodDetail(&podList.Items[0]))
+		default:
+			// The same name can exist in more than one of the configured
+			// namespaces
+			writeProblem(w, r, newProblem(http.StatusConflict, problemAmbiguousPod, fmt.Sprintf("pod %q exists in more than one namespace, pass a namespace", name)))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+
+	"github.com/go-chi/chi/v5/middleware"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// problemContentType is the media type of RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// Problem types. They're relative references, so they resolve against
+// whichever host served the error.
+const (
+	problemInvalidParameter          = "/problems/invalid-parameter"
+	problemNamespaceForbidden        = "/problems/namespace-forbidden"
+	problemNotFound                  = "/problems/not-found"
+	problemUnauthorized              = "/problems/unauthorized"
+	problemAuthenticationUnavailable = "/problems/authentication-unavailable"
+	problemMethodNotAllowed          = "/problems/method-not-allowed"
+	problemAmbiguousPod              = "/problems/ambiguous-pod"
+	problemCacheNotSynced            = "/problems/cache-not-synced"
+	problemKubernetes                = "/problems/kubernetes"
+	problemInternal                  = "/problems/internal"
+)
+
+// problem is an RFC 7807 error response, every route returns its errors as one
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+
+	// Reason is the Kubernetes StatusReason of errors from the API server
+	Reason metav1.StatusReason `json:"reason,omitempty"`
+
+	// retryAfter is sent as the Retry-After header when set, in seconds
+	retryAfter int
+}
+
+func newProblem(status int, problemType, detail string) problem {
+	return problem{
+		Type:   problemType,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func invalidParameter(err error) problem {
+	return newProblem(http.StatusBadRequest, problemInvalidParameter, err.Error())
+}
+
+func namespaceForbidden(namespace string) problem {
+	return newProblem(http.StatusForbidden, problemNamespaceForbidden, fmt.Sprintf("namespace %q is not allowed", namespace))
+}
+
+// kubernetesStatusCodes maps the reason the API server gave for failing a
+// request to what we tell our own clients. Reasons that aren't listed are a
+// bad gateway, the problem is upstream rather than with the request.
+var kubernetesStatusCodes = map[metav1.StatusReason]int{
+	metav1.StatusReasonForbidden:          http.StatusForbidden,
+	metav1.StatusReasonNotFound:           http.StatusNotFound,
+	metav1.StatusReasonBadRequest:         http.StatusBadRequest,
+	metav1.StatusReasonInvalid:            http.StatusBadRequest,
+	metav1.StatusReasonExpired:            http.StatusGone,
+	metav1.StatusReasonTimeout:            http.StatusGatewayTimeout,
+	metav1.StatusReasonServerTimeout:      http.StatusGatewayTimeout,
+	metav1.StatusReasonTooManyRequests:    http.StatusTooManyRequests,
+	metav1.StatusReasonServiceUnavailable: http.StatusServiceUnavailable,
+}
+
+// kubernetesProblem turns an error talking to the API server into a problem.
+// The details of errors that didn't come from the API server aren't shared
+// with the client.
+func kubernetesProblem(err error) problem {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return newProblem(http.StatusGatewayTimeout, problemKubernetes, "timed out waiting for the Kubernetes API server")
+	}
+
+	reason := apierrors.ReasonForError(err)
+	if reason == metav1.StatusReasonUnknown && !isAPIStatus(err) {
+		return unreachableProblem(err)
+	}
+
+	status, ok := kubernetesStatusCodes[reason]
+	if !ok {
+		status = http.StatusBadGateway
+	}
+	p := newProblem(status, problemKubernetes, err.Error())
+	p.Reason = reason
+	if delay, ok := apierrors.SuggestsClientDelay(err); ok {
+		p.retryAfter = delay
+	}
+	return p
+}
+
+// unreachableProblem is for errors that didn't come from the API server.
+// Failing to reach it is a 503, or a 504 when it timed out, with a detail that
+// doesn't give away any addresses. Anything else is a bug on our side.
+func unreachableProblem(err error) problem {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return newProblem(http.StatusGatewayTimeout, problemKubernetes, "timed out waiting for the Kubernetes API server")
+	case errors.As(err, &netErr),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return newProblem(http.StatusServiceUnavailable, problemKubernetes, "the Kubernetes API server could not be reached")
+	}
+	return newProblem(http.StatusInternalServerError, problemInternal, "")
+}
+
+func isAPIStatus(err error) bool {
+	var status apierrors.APIStatus
+	return errors.As(err, &status)
+}
+
+// writeProblem sends a problem as the response
+func writeProblem(w http.ResponseWriter, r *http.Request, p problem) {
+	p.Instance = r.URL.Path
+	p.RequestID = middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", problemContentType)
+	if p.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(p.retryAfter))
+	}
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -1,105 +1,250 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
-	"sort"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/abatilo/okteto-exercise/internal"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	"github.com/hako/durafmt"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 func (s *Server) RegisterRoutes(r *chi.Mux) {
 	r.Get("/", s.index())
 	r.Get("/api/v1/pods", s.listPods())
+	r.Get("/api/v1/watch/pods", s.watchPods())
+	r.Get("/api/v1/ws/pods", s.podsWebSocket())
+	r.Get("/api/v1/pods/{name}", s.getPod())
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, newProblem(http.StatusNotFound, problemNotFound, fmt.Sprintf("no route for %s", r.URL.Path)))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, newProblem(http.StatusMethodNotAllowed, problemMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", r.Method, r.URL.Path)))
+	})
 }
 
-func (s *Server) index() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		render.PlainText(w, r, "Hello, world!")
-	}
+// pod is the projection of a Kubernetes pod that the API returns
+type pod struct {
+	Name              string `json:"name"`
+	Namespace         string `json:"namespace"`
+	Ready             string `json:"ready"`
+	Status            string `json:"status"`
+	Restarts          int32  `json:"restarts"`
+	Age               string `json:"age"`
+	AgeSeconds        int64  `json:"ageSeconds"`
+	CreationTimestamp string `json:"creationTimestamp,omitempty"`
+	StartTime         string `json:"startTime,omitempty"`
+
+	// creationTime orders pods by age. Age itself depends on when the pod was
+	// projected, which differs between pods in a live feed.
+	creationTime time.Time
+
+	readyContainers int
+	totalContainers int
+
+	// Only returned when asked for with the fields parameter
+	podIP       string
+	node        string
+	qosClass    string
+	owner       string
+	phase       string
+	images      []string
+	labels      map[string]string
+	annotations map[string]string
 }
 
-func (s *Server) listPods() http.HandlerFunc {
-	count := s.metrics.NewGauge(internal.GaugeOpts{
-		Name: "podlist_pod_count",
-		Help: "The total number of pods being listed",
-	})
+func (s *Server) newPod(p *internal.Pod) pod {
+	totalRestarts := int32(0)
+	for _, cs := range p.Status.ContainerStatuses {
+		totalRestarts += cs.RestartCount
+	}
 
-	type pod struct {
-		Name     string `json:"name"`
-		Restarts int32  `json:"restarts"`
-		Age      string `json:"age"`
-		ageInMS  int64  `json:"-"`
+	creationTime := p.GetCreationTimestamp().Time
+	status, ready, total := internal.PodDisplayStatus(p)
+
+	var owner string
+	for _, ref := range p.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			owner = ref.Kind + "/" + ref.Name
+		}
 	}
 
-	type response struct {
-		Pods []pod `json:"pods"`
+	images := make([]string, len(p.Spec.Containers))
+	for i, c := range p.Spec.Containers {
+		images[i] = c.Image
 	}
 
-	const (
-		SortByName = iota
-		SortByRestarts
-		SortByAge
-	)
+	var startTime time.Time
+	if p.Status.StartTime != nil {
+		startTime = p.Status.StartTime.Time
+	}
 
+	age := s.clock.Now().Sub(creationTime)
+	settings := s.Settings()
+	return pod{
+		Name:              p.Name,
+		Namespace:         p.Namespace,
+		Ready:             fmt.Sprintf("%d/%d", ready, total),
+		Status:            status,
+		Restarts:          totalRestarts,
+		Age:               humanizeAge(age, settings.AgeFormat, settings.AgeUnits),
+		AgeSeconds:        int64(age / time.Second),
+		CreationTimestamp: rfc3339(creationTime),
+		StartTime:         rfc3339(startTime),
+		creationTime:      creationTime,
+
+		readyContainers: ready,
+		totalContainers: total,
+
+		podIP:       p.Status.PodIP,
+		node:        p.Spec.NodeName,
+		qosClass:    string(p.Status.QOSClass),
+		owner:       owner,
+		phase:       string(p.Status.Phase),
+		images:      images,
+		labels:      p.Labels,
+		annotations: p.Annotations,
+	}
+}
+
+type podListResponse struct {
+	Pods               []projectedPod `json:"pods"`
+	Continue           string         `json:"continue,omitempty"`
+	RemainingItemCount *int64         `json:"remainingItemCount,omitempty"`
+
+	// columns are the fields every pod was projected to, in order
+	columns []podColumn
+}
+
+// podListOptions parses the query parameters shared by every endpoint that
+// lists pods
+func podListOptions(query url.Values) (internal.PodListOptions, error) {
+	opts, err := internal.NewPodListOptions(query.Get("labelSelector"), query.Get("fieldSelector"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Namespace = query.Get("namespace")
+	if opts.Namespace != "" {
+		if errs := validation.IsDNS1123Label(opts.Namespace); len(errs) > 0 {
+			return opts, fmt.Errorf("invalid namespace: %s", strings.Join(errs, ", "))
+		}
+	}
+
+	// status accepts a comma separated list of kubectl STATUS values
+	if statusParam := query.Get("status"); statusParam != "" {
+		statuses := map[string]struct{}{}
+		for _, status := range strings.Split(statusParam, ",") {
+			statuses[strings.TrimSpace(status)] = struct{}{}
+		}
+		opts.Filter = func(p *internal.Pod) bool {
+			status, _, _ := internal.PodDisplayStatus(p)
+			_, ok := statuses[status]
+			return ok
+		}
+	}
+	return opts, nil
+}
+
+func (s *Server) index() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		sortBy := SortByName
-		sortParam := r.URL.Query().Get("sort")
+		render.PlainText(w, r, "Hello, world!")
+	}
+}
 
-		s.log.Debug().Str("sort", sortParam).Msg("Sort method")
+func (s *Server) listPods() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := negotiatePodListFormat(r)
+		if err != nil {
+			writeProblem(w, r, invalidParameter(err))
+			return
+		}
 
-		if sortParam == "restarts" {
-			sortBy = SortByRestarts
-		} else if sortParam == "age" {
-			sortBy = SortByAge
+		columns, err := parseFields(r.URL.Query().Get("fields"), format.defaultFields)
+		if err != nil {
+			writeProblem(w, r, invalidParameter(err))
+			return
 		}
 
-		podList, err := s.kubernetesClient.ListPods(r.Context())
+		query := r.URL.Query()
+		opts, err := podListOptions(query)
 		if err != nil {
-			s.log.Error().Err(err).Msg("failed to list pods")
-			render.Status(r, http.StatusInternalServerError)
+			zerolog.Ctx(r.Context()).Debug().Err(err).Msg("invalid selector")
+			writeProblem(w, r, invalidParameter(err))
 			return
 		}
 
-		pods := make([]pod, len(podList.Items))
-		for i, p := range podList.Items {
-			totalRestarts := int32(0)
-			for _, cs := range p.Status.ContainerStatuses {
-				totalRestarts += cs.RestartCount
+		if limitParam := query.Get("limit"); limitParam != "" {
+			limit, err := strconv.ParseInt(limitParam, 10, 64)
+			if err != nil || limit <= 0 {
+				writeProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "invalid limit: must be a positive integer"))
+				return
 			}
+			opts.Limit = limit
+		}
+		opts.Continue = query.Get("continue")
+
+		// Pages are cut in the namespace/name order the API server uses, so a
+		// sort would only reorder each page rather than choose which pods are
+		// on it
+		paginated := opts.Limit > 0 || opts.Continue != ""
+		sortParam := query.Get("sort")
+		if paginated && sortParam != "" {
+			writeProblem(w, r, invalidParameter(errors.New("sort can't be combined with limit or continue, pages are always in namespace and name order")))
+			return
+		}
+		if sortParam == "" && !paginated {
+			sortParam = s.Settings().DefaultSort
+		}
+		zerolog.Ctx(r.Context()).Debug().Str("sort", sortParam).Msg("Sort method")
 
-			creationTime := p.GetCreationTimestamp().Time
+		less, err := parseSort(sortParam)
+		if err != nil {
+			writeProblem(w, r, invalidParameter(err))
+			return
+		}
 
-			pods[i] = pod{
-				Name:     p.Name,
-				Restarts: totalRestarts,
-				Age:      durafmt.Parse(time.Since(creationTime)).LimitFirstN(2).String(),
-				ageInMS:  time.Since(creationTime).Milliseconds(),
-			}
+		podList, err := s.kubernetesClient.ListPods(r.Context(), opts)
+		if errors.Is(err, internal.ErrInvalidContinue) {
+			writeProblem(w, r, invalidParameter(err))
+			return
+		}
+		if errors.Is(err, internal.ErrNamespaceNotAllowed) {
+			writeProblem(w, r, namespaceForbidden(opts.Namespace))
+			return
+		}
+		if err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("failed to list pods")
+			writeProblem(w, r, kubernetesProblem(err))
+			return
 		}
 
-		if sortBy == SortByName {
-			sort.Slice(pods, func(i, j int) bool {
-				return pods[i].Name < pods[j].Name
-			})
-		} else if sortBy == SortByRestarts {
-			sort.Slice(pods, func(i, j int) bool {
-				return pods[i].Restarts < pods[j].Restarts
-			})
-		} else if sortBy == SortByAge {
-			sort.Slice(pods, func(i, j int) bool {
-				return pods[i].ageInMS < pods[j].ageInMS
-			})
+		pods := make([]pod, len(podList.Items))
+		for i := range podList.Items {
+			pods[i] = s.newPod(&podList.Items[i])
 		}
 
-		resp := response{
-			Pods: pods,
+		if !paginated {
+			sortPods(pods, less)
+		}
+
+		resp := podListResponse{
+			Pods:               make([]projectedPod, len(pods)),
+			Continue:           podList.Continue,
+			RemainingItemCount: podList.RemainingItemCount,
+			columns:            columns,
+		}
+		for i, p := range pods {
+			resp.Pods[i] = projectedPod{pod: p, columns: columns}
 		}
 
-		count.Set(float64(len(pods)))
-		render.JSON(w, r, resp)
+		format.render(w, r, resp)
 	}
 }
@@ -2,21 +2,57 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
 
 	"github.com/abatilo/okteto-exercise/internal"
 )
 
+// DefaultShutdownTimeout is how long Shutdown waits for requests to finish by
+// default. It's shorter than the 30 seconds Kubernetes gives a pod to stop.
+const DefaultShutdownTimeout = 20 * time.Second
+
 type Server struct {
-	log         zerolog.Logger
-	server      *http.Server
-	adminServer *http.Server
+	log             zerolog.Logger
+	server          *http.Server
+	adminServer     *http.Server
+	shutdownTimeout time.Duration
+
+	// logLevels changes what's logged at runtime, adminToken authorizes
+	// changing it and debugging single requests
+	logLevels  *internal.LogLevel
+	adminToken string
+
+	// tokenReviewer authenticates API requests, except for the route patterns
+	// in anonymousRoutes. Requests aren't authenticated when it's nil.
+	tokenReviewer   internal.TokenReviewer
+	anonymousRoutes map[string]bool
 
 	metrics          internal.MetricsClient
 	kubernetesClient internal.ControlPlaneClient
+	clock            internal.Clock
+	tracerProvider   internal.TracerProvider
+
+	// settings holds the Settings, they can be changed while requests are
+	// being served
+	settings atomic.Value
+
+	// shuttingDown is closed when Shutdown is called. http.Server.Shutdown
+	// doesn't cancel requests and never sees hijacked connections, so watches
+	// and WebSockets end on this rather than holding up draining.
+	shuttingDown     chan struct{}
+	stopShuttingDown sync.Once
 }
 
 // ServerOption lets you functionally control construction of the web server
@@ -29,23 +65,135 @@ func NewServer(options ...ServerOption) *Server {
 			Addr:    ":8080",
 			Handler: r,
 		},
+		shutdownTimeout: DefaultShutdownTimeout,
+		clock:           internal.RealClock{},
+		tracerProvider:  internal.NewNoopTracerProvider(),
+		shuttingDown:    make(chan struct{}),
 	}
+	s.settings.Store(DefaultSettings())
+	s.server.RegisterOnShutdown(s.endStreams)
 
 	// Overrides
 	for _, option := range options {
 		option(s)
 	}
 
+	// recoverPanics comes right after the access log and metrics, so a panic
+	// anywhere after them, authentication included, is still a logged and
+	// counted 500
+	r.Use(middleware.RequestID, echoRequestID, nameSpan(r), s.accessLog, s.instrumentRequests(r), recoverPanics, s.authenticate(r), s.debugRequests)
 	s.RegisterRoutes(r)
+	if s.tokenReviewer != nil {
+		s.warnUnknownAnonymousRoutes(r)
+	}
+	if s.logLevels != nil && s.adminServer != nil {
+		s.registerAdminRoutes()
+	}
+
+	// The span is started outside of the router so that it covers routing
+	// too, nameSpan renames it after the route once it's known. Only W3C
+	// traceparent headers are trusted to continue a trace.
+	s.server.Handler = otelhttp.NewHandler(r, "http.server",
+		otelhttp.WithTracerProvider(s.tracerProvider),
+		otelhttp.WithPropagators(propagation.TraceContext{}),
+	)
 	return s
 }
 
+// Start serves the API and the admin server until Shutdown is called or
+// either of them fails. Both addresses are bound before anything is served, so
+// an address that's already in use is returned straight away. Start returns
+// http.ErrServerClosed after a Shutdown.
 func (s *Server) Start() error {
-	return s.server.ListenAndServe()
+	servers := s.servers()
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, srv := range servers {
+		addr := srv.Addr
+		if addr == "" {
+			addr = ":http"
+		}
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		s.log.Info().Str("addr", listeners[i].Addr().String()).Msg("Listening")
+		go func(srv *http.Server, listener net.Listener) {
+			errs <- srv.Serve(listener)
+		}(srv, listeners[i])
+	}
+
+	err := <-errs
+	if !errors.Is(err, http.ErrServerClosed) {
+		// Don't leave the other server running on its own
+		s.Shutdown(context.Background())
+	}
+	return err
 }
 
+// Shutdown stops both servers from accepting connections and waits for the
+// requests they're serving to finish, for up to the shutdown timeout. Watches
+// and WebSockets are ended straight away, clients reconnect to another
+// replica. Connections that are still open after the timeout are closed.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+	ctx, cancel := context.WithTimeout(ctx, s.shutdownTimeout)
+	defer cancel()
+
+	servers := s.servers()
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				srv.Close()
+				errs[i] = err
+			}
+		}(i, srv)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endStreams tells streaming handlers to return. Shutdown can be called more
+// than once.
+func (s *Server) endStreams() {
+	s.stopShuttingDown.Do(func() {
+		close(s.shuttingDown)
+	})
+}
+
+// registerAdminRoutes adds the server's own routes to the admin server
+func (s *Server) registerAdminRoutes() {
+	next := s.adminServer.Handler
+	if next == nil {
+		next = http.DefaultServeMux
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/loglevel", s.logLevel())
+	mux.Handle("/", next)
+	s.adminServer.Handler = mux
+}
+
+func (s *Server) servers() []*http.Server {
+	if s.adminServer == nil {
+		return []*http.Server{s.server}
+	}
+	return []*http.Server{s.server, s.adminServer}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -58,6 +206,37 @@ func WithLogger(log zerolog.Logger) ServerOption {
 	}
 }
 
+// WithAddr sets the address the API listens on, :8080 by default
+func WithAddr(addr string) ServerOption {
+	return func(s *Server) {
+		s.server.Addr = addr
+	}
+}
+
+// WithShutdownTimeout sets how long Shutdown waits for requests to finish
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// WithLogLevel adds /loglevel to the admin server to change the level at
+// runtime, and lets requests ask to be logged at debug level with the
+// X-Debug-Token header
+func WithLogLevel(logLevels *internal.LogLevel) ServerOption {
+	return func(s *Server) {
+		s.logLevels = logLevels
+	}
+}
+
+// WithAdminToken protects changing the log level and debugging requests
+func WithAdminToken(token string) ServerOption {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithAdminServer is started and stopped along with the API
 func WithAdminServer(adminServer *http.Server) ServerOption {
 	return func(s *Server) {
 		s.adminServer = adminServer
@@ -75,3 +254,29 @@ func WithKubernetesClient(clientset internal.ControlPlaneClient) ServerOption {
 		s.kubernetesClient = clientset
 	}
 }
+
+// WithClock replaces the clock used to calculate pod ages
+func WithClock(clock internal.Clock) ServerOption {
+	return func(s *Server) {
+		s.clock = clock
+	}
+}
+
+// WithAgeFormat sets how pod ages are humanized. units limits the number of
+// units written by AgeFormatLong.
+func WithAgeFormat(format AgeFormat, units int) ServerOption {
+	return func(s *Server) {
+		settings := s.Settings()
+		settings.AgeFormat = format
+		settings.AgeUnits = units
+		s.settings.Store(settings)
+	}
+}
+
+// WithTracerProvider records a span for every request, continuing the trace of
+// a traceparent header when the client sends one
+func WithTracerProvider(tracerProvider internal.TracerProvider) ServerOption {
+	return func(s *Server) {
+		s.tracerProvider = tracerProvider
+	}
+}
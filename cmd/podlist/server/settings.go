@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Settings are the parts of the server's configuration that are safe to
+// change while it's serving, with UpdateSettings
+type Settings struct {
+	// AgeFormat is how pod ages are humanized, AgeUnits limits the number of
+	// units written by AgeFormatLong
+	AgeFormat AgeFormat
+	AgeUnits  int
+
+	// DefaultSort orders pod lists that don't ask for a sort, like
+	// "-restarts,name". Empty sorts by name.
+	DefaultSort string
+}
+
+// DefaultSettings are used unless they're overridden
+func DefaultSettings() Settings {
+	return Settings{
+		AgeFormat: AgeFormatLong,
+		AgeUnits:  DefaultAgeUnits,
+	}
+}
+
+// Validate checks every setting, returning the first that's invalid
+func (s Settings) Validate() error {
+	if _, err := ParseAgeFormat(string(s.AgeFormat)); err != nil {
+		return err
+	}
+	if s.AgeUnits < 1 {
+		return errors.New("invalid age units: must be at least 1")
+	}
+	if _, err := parseSort(s.DefaultSort); err != nil {
+		return fmt.Errorf("invalid default sort: %w", err)
+	}
+	return nil
+}
+
+// WithSettings replaces the default settings
+func WithSettings(settings Settings) ServerOption {
+	return func(s *Server) {
+		s.settings.Store(settings)
+	}
+}
+
+// UpdateSettings changes the settings of a running server. Invalid settings
+// are returned as an error and not applied.
+func (s *Server) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	s.settings.Store(settings)
+	return nil
+}
+
+// Settings returns the settings requests are currently served with
+func (s *Server) Settings() Settings {
+	return s.settings.Load().(Settings)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// podComparators compare pods on a single column, returning a negative number
+// when a sorts before b, a positive one when it sorts after, and 0 otherwise
+var podComparators = map[string]func(a, b pod) int{
+	"name": func(a, b pod) int {
+		return strings.Compare(a.Name, b.Name)
+	},
+	"namespace": func(a, b pod) int {
+		return strings.Compare(a.Namespace, b.Namespace)
+	},
+	"node": func(a, b pod) int {
+		return strings.Compare(a.node, b.node)
+	},
+	"status": func(a, b pod) int {
+		return strings.Compare(a.Status, b.Status)
+	},
+	// Least ready first, so pods that need attention come up top. Pods that
+	// aren't fully ready come before those that are, then the lowest share
+	// of ready containers, then the most containers.
+	"ready": func(a, b pod) int {
+		aReady := a.readyContainers == a.totalContainers
+		bReady := b.readyContainers == b.totalContainers
+		if c := compareBools(aReady, bReady); c != 0 {
+			return c
+		}
+		// a.ready/a.total against b.ready/b.total, without dividing
+		if c := compareInts(int64(a.readyContainers)*int64(b.totalContainers), int64(b.readyContainers)*int64(a.totalContainers)); c != 0 {
+			return c
+		}
+		return compareInts(int64(b.totalContainers), int64(a.totalContainers))
+	},
+	"restarts": func(a, b pod) int {
+		return compareInts(int64(a.Restarts), int64(b.Restarts))
+	},
+	// Youngest first, a later creation time is a smaller age
+	"age": func(a, b pod) int {
+		return compareTimes(b.creationTime, a.creationTime)
+	},
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareBools sorts false before true
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	}
+	return 1
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// parseSort turns a sort parameter like "-restarts,name" into an ordering.
+// Keys are applied in order, a leading '-' sorts that key descending, and
+// pods that are still tied are ordered by namespace and name so the result is
+// always the same. An empty parameter sorts by name.
+func parseSort(sortParam string) (func(a, b pod) bool, error) {
+	type sortKey struct {
+		compare    func(a, b pod) int
+		descending bool
+	}
+
+	var keys []sortKey
+	if sortParam != "" {
+		for _, field := range strings.Split(sortParam, ",") {
+			field = strings.TrimSpace(field)
+			descending := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+
+			compare, ok := podComparators[field]
+			if !ok {
+				return nil, fmt.Errorf("invalid sort: unknown key %q", field)
+			}
+			keys = append(keys, sortKey{compare: compare, descending: descending})
+		}
+	}
+	keys = append(keys,
+		sortKey{compare: podComparators["name"]},
+		sortKey{compare: podComparators["namespace"]},
+	)
+
+	return func(a, b pod) bool {
+		for _, key := range keys {
+			c := key.compare(a, b)
+			if key.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	}, nil
+}
+
+func sortPods(pods []pod, less func(a, b pod) bool) {
+	sort.SliceStable(pods, func(i, j int) bool {
+		return less(pods[i], pods[j])
+	})
+}
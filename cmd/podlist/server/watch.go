@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/abatilo/okteto-exercise/internal"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// watchHeartbeatInterval keeps idle streams from being closed by proxies
+	// and lets clients notice a dead connection
+	watchHeartbeatInterval = 15 * time.Second
+
+	// watchRetry is how long browsers wait before reconnecting, in
+	// milliseconds
+	watchRetry = 3000
+
+	// watchResetEvent tells clients to throw away what they have, the ADDED
+	// events that follow are every pod that currently exists
+	watchResetEvent = "RESET"
+)
+
+// watchPods streams pod changes as Server-Sent Events. Every event carries an
+// ID, and a client that reconnects with it in the Last-Event-ID header
+// continues where it left off.
+func (s *Server) watchPods() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeProblem(w, r, newProblem(http.StatusInternalServerError, problemInternal, "streaming is not supported"))
+			return
+		}
+
+		opts, err := podListOptions(r.URL.Query())
+		if err != nil {
+			writeProblem(w, r, invalidParameter(err))
+			return
+		}
+
+		// An ID this process didn't hand out, from another replica or from
+		// before a restart, starts over with a snapshot
+		watch, err := s.kubernetesClient.WatchPods(r.Context(), opts, r.Header.Get("Last-Event-ID"))
+		if errors.Is(err, internal.ErrNamespaceNotAllowed) {
+			writeProblem(w, r, namespaceForbidden(opts.Namespace))
+			return
+		}
+		if errors.Is(err, internal.ErrCacheNotSynced) {
+			p := newProblem(http.StatusServiceUnavailable, problemCacheNotSynced, err.Error())
+			p.retryAfter = 5
+			writeProblem(w, r, p)
+			return
+		}
+		if err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("failed to watch pods")
+			writeProblem(w, r, kubernetesProblem(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: %d\n\n", watchRetry)
+		if watch.Snapshot {
+			writeWatchEvent(w, "", watchResetEvent, struct{}{})
+		}
+		for _, e := range watch.Initial {
+			writeWatchEvent(w, e.ID, string(e.Type), s.newPod(e.Pod))
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(watchHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-s.shuttingDown:
+				// The client reconnects to another replica, which sends it
+				// a snapshot since it didn't hand out the Last-Event-ID
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
+			case e, ok := <-watch.Events:
+				if !ok {
+					// We fell too far behind, closing the stream makes the
+					// client reconnect and resume from its last event
+					zerolog.Ctx(r.Context()).Debug().Msg("pod watcher dropped")
+					return
+				}
+				writeWatchEvent(w, e.ID, string(e.Type), s.newPod(e.Pod))
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeWatchEvent(w io.Writer, id string, eventType string, data interface{}) {
+	b, _ := json.Marshal(data)
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, b)
+}
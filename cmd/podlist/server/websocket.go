@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abatilo/okteto-exercise/internal"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// wsSendBuffer is how many messages can be queued for a client before it's
+	// considered too slow and switched over to receiving a fresh snapshot
+	wsSendBuffer = 64
+
+	// wsResyncInterval is how often a slow client is checked for having caught
+	// up so it can be sent a snapshot
+	wsResyncInterval = time.Second
+
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = wsPongTimeout * 9 / 10
+)
+
+// wsSubscribeRequest is sent by clients to start, or replace, their
+// subscription. The fields mirror the /api/v1/pods query parameters.
+type wsSubscribeRequest struct {
+	Type          string `json:"type"`
+	Namespace     string `json:"namespace"`
+	LabelSelector string `json:"labelSelector"`
+	FieldSelector string `json:"fieldSelector"`
+	Status        string `json:"status"`
+	Sort          string `json:"sort"`
+}
+
+// wsSnapshot replaces the client's whole list
+type wsSnapshot struct {
+	Type string `json:"type"`
+	Pods []pod  `json:"pods"`
+}
+
+// wsDiff is applied to the client's list in order
+type wsDiff struct {
+	Type string     `json:"type"`
+	Ops  []wsDiffOp `json:"ops"`
+}
+
+// wsDiffOp inserts, updates or removes the pod at an index of the sorted list
+type wsDiffOp struct {
+	Op    string `json:"op"`
+	Index int    `json:"index"`
+	Pod   *pod   `json:"pod,omitempty"`
+}
+
+type wsError struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// podsWebSocket serves a live, sorted pod table. After a subscribe message
+// the client receives a snapshot of the list followed by diffs as pods change.
+func (s *Server) podsWebSocket() http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			writeProblem(w, r, newProblem(status, problemInvalidParameter, reason.Error()))
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			zerolog.Ctx(r.Context()).Debug().Err(err).Msg("failed to upgrade websocket")
+			return
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		out := make(chan interface{}, wsSendBuffer)
+		writerDone := make(chan struct{})
+		go func() {
+			defer close(writerDone)
+			s.writeWebSocket(conn, out)
+			// Unblock the reader if writing failed
+			conn.Close()
+		}()
+
+		var subscriptions sync.WaitGroup
+		cancelSubscription := func() {}
+
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+
+		// Stop reading when the server shuts down, which closes the
+		// connection like the client leaving does
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-s.shuttingDown:
+				conn.SetReadDeadline(time.Now())
+			}
+		}()
+
+		for {
+			var req wsSubscribeRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				break
+			}
+			if req.Type != "subscribe" {
+				trySend(out, wsError{Type: "error", Error: fmt.Sprintf("unknown message type %q", req.Type)})
+				continue
+			}
+
+			sortParam := req.Sort
+			if sortParam == "" {
+				sortParam = s.Settings().DefaultSort
+			}
+			less, err := parseSort(sortParam)
+			if err != nil {
+				trySend(out, wsError{Type: "error", Error: err.Error()})
+				continue
+			}
+
+			opts, err := podListOptions(url.Values{
+				"namespace":     {req.Namespace},
+				"labelSelector": {req.LabelSelector},
+				"fieldSelector": {req.FieldSelector},
+				"status":        {req.Status},
+			})
+			if err != nil {
+				trySend(out, wsError{Type: "error", Error: err.Error()})
+				continue
+			}
+
+			// A new subscription replaces the current one
+			cancelSubscription()
+			subscriptions.Wait()
+
+			var subCtx context.Context
+			subCtx, cancelSubscription = context.WithCancel(ctx)
+			subscriptions.Add(1)
+			go func() {
+				defer subscriptions.Done()
+				s.streamPodFeed(subCtx, out, opts, less)
+			}()
+		}
+
+		cancelSubscription()
+		cancel()
+		subscriptions.Wait()
+		close(out)
+		<-writerDone
+	}
+}
+
+// writeWebSocket is the only goroutine writing to the connection
+func (s *Server) writeWebSocket(conn *websocket.Conn, out <-chan interface{}) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case msg, ok := <-out:
+			if !ok {
+				code := websocket.CloseNormalClosure
+				select {
+				case <-s.shuttingDown:
+					code = websocket.CloseGoingAway
+				default:
+				}
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(wsWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(msg); err != nil {
+				s.log.Debug().Err(err).Msg("failed to write websocket message")
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamPodFeed keeps a sorted list for one subscription and queues diffs for
+// the client. When the client can't keep up the pending diffs are dropped and
+// it's sent a snapshot once it has drained its queue.
+func (s *Server) streamPodFeed(ctx context.Context, out chan<- interface{}, opts internal.PodListOptions, less func(a, b pod) bool) {
+	var feed *podFeed
+	var events <-chan internal.PodEvent
+	resync := false
+
+	resyncTicker := time.NewTicker(wsResyncInterval)
+	defer resyncTicker.Stop()
+
+	// Every watch gets its own context, so the one that dropped us is
+	// cleaned up before watching again
+	cancelWatch := func() {}
+	defer func() { cancelWatch() }()
+
+	for {
+		if events == nil {
+			cancelWatch()
+			watchCtx, cancel := context.WithCancel(ctx)
+			cancelWatch = cancel
+			watch, err := s.kubernetesClient.WatchPods(watchCtx, opts, "")
+			if errors.Is(err, internal.ErrCacheNotSynced) {
+				// Wait for the cache rather than failing the subscription
+				select {
+				case <-ctx.Done():
+					return
+				case <-resyncTicker.C:
+					continue
+				}
+			}
+			if err != nil {
+				trySend(out, wsError{Type: "error", Error: err.Error()})
+				return
+			}
+
+			feed = newPodFeed(less, s.newPod, watch.Initial)
+			events = watch.Events
+			resync = !trySend(out, feed.snapshot())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-resyncTicker.C:
+			if resync && len(out) == 0 {
+				resync = !trySend(out, feed.snapshot())
+			}
+		case e, ok := <-events:
+			if !ok {
+				// The watch dropped us, start over from a new snapshot
+				events = nil
+				continue
+			}
+			ops := feed.apply(e)
+			if len(ops) == 0 || resync {
+				continue
+			}
+			resync = !trySend(out, wsDiff{Type: "diff", Ops: ops})
+		}
+	}
+}
+
+func trySend(out chan<- interface{}, msg interface{}) bool {
+	select {
+	case out <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// podFeed is a sorted pod list that turns pod events into index based diffs.
+// The ordering from parseSort is total, so every client agrees on where a pod
+// belongs.
+type podFeed struct {
+	less   func(a, b pod) bool
+	newPod func(p *internal.Pod) pod
+	pods   []pod
+
+	// sources are the pods the list was projected from, by namespace/name
+	sources map[string]*internal.Pod
+}
+
+func newPodFeed(less func(a, b pod) bool, newPod func(p *internal.Pod) pod, initial []internal.PodEvent) *podFeed {
+	f := &podFeed{less: less, newPod: newPod, sources: map[string]*internal.Pod{}}
+	for _, e := range initial {
+		f.apply(e)
+	}
+	return f
+}
+
+// snapshot projects every pod again, so ages are as of now rather than when
+// each pod last changed. Ages are ordered by creation time, so the order
+// stays the same.
+func (f *podFeed) snapshot() wsSnapshot {
+	pods := make([]pod, len(f.pods))
+	for i, p := range f.pods {
+		pods[i] = f.newPod(f.sources[p.Namespace+"/"+p.Name])
+	}
+	return wsSnapshot{Type: "snapshot", Pods: pods}
+}
+
+func (f *podFeed) indexOf(namespace, name string) int {
+	for i, p := range f.pods {
+		if p.Namespace == namespace && p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *podFeed) apply(e internal.PodEvent) []wsDiffOp {
+	var ops []wsDiffOp
+
+	current := f.indexOf(e.Pod.Namespace, e.Pod.Name)
+	if e.Type == internal.PodDeleted {
+		if current < 0 {
+			return nil
+		}
+		f.pods = append(f.pods[:current], f.pods[current+1:]...)
+		delete(f.sources, e.Pod.Namespace+"/"+e.Pod.Name)
+		return []wsDiffOp{{Op: "remove", Index: current}}
+	}
+
+	// ADDED and MODIFIED are both upserts, a snapshot can race with the
+	// events that follow it
+	p := f.newPod(e.Pod)
+	f.sources[e.Pod.Namespace+"/"+e.Pod.Name] = e.Pod
+	if current >= 0 {
+		f.pods = append(f.pods[:current], f.pods[current+1:]...)
+	}
+
+	index := sort.Search(len(f.pods), func(i int) bool {
+		return f.less(p, f.pods[i])
+	})
+	f.pods = append(f.pods, pod{})
+	copy(f.pods[index+1:], f.pods[index:])
+	f.pods[index] = p
+
+	if current == index {
+		return []wsDiffOp{{Op: "update", Index: index, Pod: &p}}
+	}
+	if current >= 0 {
+		ops = append(ops, wsDiffOp{Op: "remove", Index: current})
+	}
+	return append(ops, wsDiffOp{Op: "insert", Index: index, Pod: &p})
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abatilo/okteto-exercise/internal"
+	"github.com/rs/zerolog"
+)
+
+// feedClient hands out a new events channel for every watch and keeps the
+// watch's context
+type feedClient struct {
+	internal.MockKubernetesClient
+	watches chan feedWatch
+}
+
+type feedWatch struct {
+	ctx    context.Context
+	events chan internal.PodEvent
+}
+
+func (c *feedClient) WatchPods(ctx context.Context, opts internal.PodListOptions, lastEventID string) (*internal.PodWatch, error) {
+	watch, err := c.MockKubernetesClient.WatchPods(ctx, opts, lastEventID)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan internal.PodEvent)
+	watch.Events = events
+	c.watches <- feedWatch{ctx: ctx, events: events}
+	return watch, nil
+}
+
+// lockedClock can be moved forward while the feed is reading it
+type lockedClock struct {
+	mu   sync.Mutex
+	time time.Time
+}
+
+func (c *lockedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.time
+}
+
+func (c *lockedClock) add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.time = c.time.Add(d)
+}
+
+func Test_streamPodFeedSlowClient(t *testing.T) {
+	clock := &lockedClock{time: time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)}
+	created := internal.Time{Time: clock.Now().Add(-time.Minute)}
+	mockPod := func(restarts int32) *internal.Pod {
+		return &internal.Pod{
+			ObjectMeta: internal.ObjectMeta{Name: "AAA", CreationTimestamp: created},
+			Status: internal.PodStatus{
+				ContainerStatuses: []internal.ContainerStatuses{{RestartCount: restarts}},
+			},
+		}
+	}
+
+	client := &feedClient{
+		MockKubernetesClient: internal.MockKubernetesClient{PodList: &internal.PodList{Items: []internal.Pod{*mockPod(0)}}},
+		watches:              make(chan feedWatch, 1),
+	}
+	s := NewServer(
+		WithLogger(zerolog.New(ioutil.Discard)),
+		WithMetrics(&internal.NoopMetrics{}),
+		WithKubernetesClient(client),
+		WithClock(clock),
+	)
+	less, _ := parseSort("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan interface{}, wsSendBuffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.streamPodFeed(ctx, out, internal.PodListOptions{}, less)
+	}()
+	watch := <-client.watches
+
+	// The client doesn't read, so the queue fills up with the snapshot and
+	// diffs, and the diffs after that are dropped
+	for i := int32(1); i <= wsSendBuffer+10; i++ {
+		watch.events <- internal.PodEvent{Type: internal.PodModified, Pod: mockPod(i)}
+	}
+	clock.add(time.Hour)
+	watch.events <- internal.PodEvent{Type: internal.PodModified, Pod: mockPod(100)}
+
+	if _, ok := (<-out).(wsSnapshot); !ok {
+		t.Fatalf("expected the first message to be the snapshot")
+	}
+	for i := 1; i < wsSendBuffer; i++ {
+		if _, ok := (<-out).(wsDiff); !ok {
+			t.Fatalf("expected message %d to be a diff", i)
+		}
+	}
+
+	// Once it has caught up it gets a single snapshot of the current list,
+	// with ages as of now
+	select {
+	case msg := <-out:
+		snapshot, ok := msg.(wsSnapshot)
+		if !ok {
+			t.Fatalf("expected a snapshot after catching up, got %+v", msg)
+		}
+		if len(snapshot.Pods) != 1 || snapshot.Pods[0].Restarts != 100 || snapshot.Pods[0].AgeSeconds != 3660 {
+			t.Errorf("expected AAA with 100 restarts and an age of 3660s, got %+v", snapshot.Pods)
+		}
+	case <-time.After(5 * wsResyncInterval):
+		t.Fatalf("expected a snapshot after catching up")
+	}
+	select {
+	case msg := <-out:
+		t.Errorf("expected a single snapshot, got %+v", msg)
+	case <-time.After(2 * wsResyncInterval):
+	}
+
+	// and diffs after that
+	watch.events <- internal.PodEvent{Type: internal.PodModified, Pod: mockPod(101)}
+	if _, ok := (<-out).(wsDiff); !ok {
+		t.Errorf("expected diffs to resume")
+	}
+
+	// A watch that drops the feed is cleaned up before watching again
+	close(watch.events)
+	next := <-client.watches
+	if watch.ctx.Err() == nil {
+		t.Errorf("expected the dropped watch's context to be cancelled")
+	}
+	if next.ctx.Err() != nil {
+		t.Errorf("expected the new watch's context to be live")
+	}
+
+	cancel()
+	<-done
+}
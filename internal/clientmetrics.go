@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+// registerClientMetrics makes sure client-go's global metric hooks are only
+// registered once, client-go ignores every registration after the first
+var registerClientMetrics sync.Once
+
+// apiServerMetrics records every request made to the Kubernetes API server
+type apiServerMetrics struct {
+	requests    *CounterVec
+	duration    *HistogramVec
+	rateLimiter *HistogramVec
+}
+
+func newAPIServerMetrics(metrics MetricsClient) *apiServerMetrics {
+	m := &apiServerMetrics{
+		requests: metrics.NewCounterVec(CounterOpts{
+			Name: "podlist_kubernetes_requests_total",
+			Help: "Number of requests made to the Kubernetes API server",
+		}, []string{"verb", "resource", "code"}),
+		duration: metrics.NewHistogramVec(HistogramOpts{
+			Name:    "podlist_kubernetes_request_duration_seconds",
+			Help:    "How long requests to the Kubernetes API server took to respond, watches are timed until the response headers",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"verb", "resource"}),
+		rateLimiter: metrics.NewHistogramVec(HistogramOpts{
+			Name:    "podlist_kubernetes_rate_limiter_duration_seconds",
+			Help:    "How long requests to the Kubernetes API server waited on client-go's rate limiter",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"verb"}),
+	}
+
+	registerClientMetrics.Do(func() {
+		clientmetrics.Register(clientmetrics.RegisterOpts{
+			RateLimiterLatency: m,
+		})
+	})
+	return m
+}
+
+// Observe implements client-go's LatencyMetric for the rate limiter. The URL
+// isn't used as a label since it includes pod names.
+func (m *apiServerMetrics) Observe(ctx context.Context, verb string, u url.URL, latency time.Duration) {
+	m.rateLimiter.WithLabelValues(strings.ToLower(verb)).Observe(latency.Seconds())
+}
+
+// wrap instruments a rest.Config's transport
+func (m *apiServerMetrics) wrap(rt http.RoundTripper) http.RoundTripper {
+	return &instrumentedRoundTripper{metrics: m, next: rt}
+}
+
+type instrumentedRoundTripper struct {
+	metrics *apiServerMetrics
+	next    http.RoundTripper
+}
+
+func (rt *instrumentedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+
+	verb, resource := requestVerbAndResource(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	rt.metrics.requests.WithLabelValues(verb, resource, code).Inc()
+	rt.metrics.duration.WithLabelValues(verb, resource).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// WrappedRoundTripper lets client-go see through the instrumentation, it uses
+// this to find the transport to cancel requests on
+func (rt *instrumentedRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.next
+}
+
+// requestVerbAndResource works out the Kubernetes verb and resource of an API
+// request from its method and path, like "list" and "pods" for
+// GET /api/v1/namespaces/default/pods. Paths outside of the resource API, like
+// /healthz, are their own resource.
+func requestVerbAndResource(req *http.Request) (verb, resource string) {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	var rest []string
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		rest = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		rest = segments[3:]
+	default:
+		return strings.ToLower(req.Method), req.URL.Path
+	}
+
+	// namespaces/{namespace}/{resource} is a namespaced resource, while
+	// namespaces and namespaces/{name} are the namespaces themselves
+	if len(rest) >= 3 && rest[0] == "namespaces" {
+		rest = rest[2:]
+	}
+	if len(rest) == 0 {
+		// Discovery of the group version
+		return strings.ToLower(req.Method), req.URL.Path
+	}
+
+	resource = rest[0]
+	named := len(rest) >= 2
+	if len(rest) >= 3 {
+		resource += "/" + rest[2]
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		switch {
+		case req.URL.Query().Get("watch") == "true":
+			verb = "watch"
+		case named:
+			verb = "get"
+		default:
+			verb = "list"
+		}
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodPut:
+		verb = "update"
+	case http.MethodPatch:
+		verb = "patch"
+	case http.MethodDelete:
+		verb = "delete"
+		if !named {
+			verb = "deletecollection"
+		}
+	default:
+		verb = strings.ToLower(req.Method)
+	}
+	return verb, resource
+}
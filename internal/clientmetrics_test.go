@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_requestVerbAndResource(t *testing.T) {
+	type test struct {
+		method           string
+		url              string
+		expectedVerb     string
+		expectedResource string
+	}
+
+	tests := []test{
+		{method: "GET", url: "/api/v1/namespaces/default/pods", expectedVerb: "list", expectedResource: "pods"},
+		{method: "GET", url: "/api/v1/pods?watch=true&resourceVersion=42", expectedVerb: "watch", expectedResource: "pods"},
+		{method: "GET", url: "/api/v1/namespaces/default/pods/web-1", expectedVerb: "get", expectedResource: "pods"},
+		{method: "GET", url: "/api/v1/namespaces/default/pods/web-1/log", expectedVerb: "get", expectedResource: "pods/log"},
+		{method: "GET", url: "/api/v1/namespaces/default", expectedVerb: "get", expectedResource: "namespaces"},
+		{method: "POST", url: "/apis/authentication.k8s.io/v1/tokenreviews", expectedVerb: "create", expectedResource: "tokenreviews"},
+		{method: "DELETE", url: "/apis/apps/v1/namespaces/default/deployments", expectedVerb: "deletecollection", expectedResource: "deployments"},
+		{method: "GET", url: "/healthz", expectedVerb: "get", expectedResource: "/healthz"},
+		{method: "GET", url: "/apis/apps/v1", expectedVerb: "get", expectedResource: "/apis/apps/v1"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, nil)
+		verb, resource := requestVerbAndResource(req)
+		if verb != test.expectedVerb || resource != test.expectedResource {
+			t.Errorf("%s %s: expected %s %s, got %s %s", test.method, test.url, test.expectedVerb, test.expectedResource, verb, resource)
+		}
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func Test_apiServerMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := newAPIServerMetrics(&PrometheusMetrics{Registerer: registry})
+
+	rt := m.wrap(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/healthz" {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusForbidden}, nil
+	}))
+
+	for _, url := range []string{"/api/v1/namespaces/default/pods", "/api/v1/namespaces/default/pods", "/healthz"} {
+		rt.RoundTrip(httptest.NewRequest(http.MethodGet, url, nil))
+	}
+
+	expected := `
+# HELP podlist_kubernetes_requests_total Number of requests made to the Kubernetes API server
+# TYPE podlist_kubernetes_requests_total counter
+podlist_kubernetes_requests_total{code="403",resource="pods",verb="list"} 2
+podlist_kubernetes_requests_total{code="error",resource="/healthz",verb="get"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "podlist_kubernetes_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if count, err := testutil.GatherAndCount(registry, "podlist_kubernetes_request_duration_seconds"); err != nil || count != 2 {
+		t.Errorf("expected 2 latency histograms, got %d (%v)", count, err)
+	}
+}
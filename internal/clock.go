@@ -0,0 +1,27 @@
+package internal
+
+import "time"
+
+// Clock tells the time. Everything that depends on the current time, like pod
+// ages, goes through one so that tests can pin it.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the system clock
+type RealClock struct{}
+
+// Now returns the current time
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// MockClock is a clock that's stopped at Time
+type MockClock struct {
+	Time time.Time
+}
+
+// Now returns the mocked time
+func (m *MockClock) Now() time.Time {
+	return m.Time
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultPodMetricsLimit is how many pods get their own series by default
+const DefaultPodMetricsLimit = 1000
+
+var (
+	podCountDesc = prometheus.NewDesc(
+		"podlist_pod_count",
+		"Number of pods in the cache",
+		nil, nil,
+	)
+	podPhaseDesc = prometheus.NewDesc(
+		"podlist_pods",
+		"Number of pods by namespace and phase",
+		[]string{"namespace", "phase"}, nil,
+	)
+	podRestartsDesc = prometheus.NewDesc(
+		"podlist_pod_restarts_total",
+		"Number of times the pod's containers have restarted",
+		[]string{"namespace", "pod"}, nil,
+	)
+	podReadyContainersDesc = prometheus.NewDesc(
+		"podlist_pod_containers_ready",
+		"Number of the pod's containers that are ready",
+		[]string{"namespace", "pod"}, nil,
+	)
+	podContainersDesc = prometheus.NewDesc(
+		"podlist_pod_containers",
+		"Number of containers in the pod",
+		[]string{"namespace", "pod"}, nil,
+	)
+	podAgeDesc = prometheus.NewDesc(
+		"podlist_pod_age_seconds",
+		"Time since the pod was created",
+		[]string{"namespace", "pod"}, nil,
+	)
+	podSeriesDroppedDesc = prometheus.NewDesc(
+		"podlist_pod_metrics_dropped",
+		"Number of pods left out of the per pod metrics because of the limit",
+		nil, nil,
+	)
+)
+
+// phases are always reported so that a phase with no pods is a 0 rather than
+// a missing series
+var phases = []string{"Pending", "Running", "Succeeded", "Failed", "Unknown"}
+
+// PodCollector reports metrics about the cached pods every time it's scraped,
+// so they're never staler than the cache. The per pod series are limited to
+// the first limit pods by namespace and name, podlist_pod_metrics_dropped
+// counts the rest. Counts by phase always include every pod.
+type PodCollector struct {
+	client ControlPlaneClient
+	clock  Clock
+	limit  int
+}
+
+// NewPodCollector creates a collector for the client's pod cache
+func NewPodCollector(client ControlPlaneClient, clock Clock, limit int) *PodCollector {
+	return &PodCollector{client: client, clock: clock, limit: limit}
+}
+
+// Describe implements prometheus.Collector
+func (c *PodCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- podCountDesc
+	ch <- podPhaseDesc
+	ch <- podRestartsDesc
+	ch <- podReadyContainersDesc
+	ch <- podContainersDesc
+	ch <- podAgeDesc
+	ch <- podSeriesDroppedDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *PodCollector) Collect(ch chan<- prometheus.Metric) {
+	pods, err := c.client.CachedPods()
+	if err != nil {
+		// Nothing is better than numbers that look real but aren't, the
+		// cache-synced health check reports why
+		return
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		return podKey(pods[i]) < podKey(pods[j])
+	})
+
+	ch <- prometheus.MustNewConstMetric(podCountDesc, prometheus.GaugeValue, float64(len(pods)))
+
+	byPhase := map[string]map[string]int{}
+	for _, p := range pods {
+		if byPhase[p.Namespace] == nil {
+			byPhase[p.Namespace] = map[string]int{}
+		}
+		byPhase[p.Namespace][string(p.Status.Phase)]++
+	}
+	for namespace, counts := range byPhase {
+		for _, phase := range phases {
+			ch <- prometheus.MustNewConstMetric(podPhaseDesc, prometheus.GaugeValue, float64(counts[phase]), namespace, phase)
+		}
+	}
+
+	dropped := 0
+	now := c.clock.Now()
+	for i, p := range pods {
+		if i >= c.limit {
+			dropped = len(pods) - c.limit
+			break
+		}
+
+		var restarts int32
+		for _, cs := range p.Status.ContainerStatuses {
+			restarts += cs.RestartCount
+		}
+		_, ready, total := PodDisplayStatus(p)
+
+		ch <- prometheus.MustNewConstMetric(podRestartsDesc, prometheus.CounterValue, float64(restarts), p.Namespace, p.Name)
+		ch <- prometheus.MustNewConstMetric(podReadyContainersDesc, prometheus.GaugeValue, float64(ready), p.Namespace, p.Name)
+		ch <- prometheus.MustNewConstMetric(podContainersDesc, prometheus.GaugeValue, float64(total), p.Namespace, p.Name)
+		ch <- prometheus.MustNewConstMetric(podAgeDesc, prometheus.GaugeValue, now.Sub(p.CreationTimestamp.Time).Seconds(), p.Namespace, p.Name)
+	}
+	ch <- prometheus.MustNewConstMetric(podSeriesDroppedDesc, prometheus.GaugeValue, float64(dropped))
+}
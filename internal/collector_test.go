@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_PodCollector(t *testing.T) {
+	now := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	pod := func(namespace, name string, phase v1.PodPhase, age time.Duration, restarts int32, ready bool) Pod {
+		return Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         namespace,
+				Name:              name,
+				CreationTimestamp: metav1.Time{Time: now.Add(-age)},
+			},
+			Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+			Status: v1.PodStatus{
+				Phase: phase,
+				ContainerStatuses: []v1.ContainerStatus{{
+					Name:         "app",
+					Ready:        ready,
+					RestartCount: restarts,
+					State:        v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				}},
+			},
+		}
+	}
+
+	client := &MockKubernetesClient{
+		Synced: true,
+		PodList: &PodList{Items: []Pod{
+			pod("default", "web", "Running", time.Hour, 3, true),
+			pod("default", "api", "Pending", time.Minute, 0, false),
+			pod("kube-system", "dns", "Running", 24*time.Hour, 1, true),
+		}},
+	}
+
+	// Only the first two pods by namespace and name get their own series
+	collector := NewPodCollector(client, &MockClock{Time: now}, 2)
+	expected := `
+# HELP podlist_pod_age_seconds Time since the pod was created
+# TYPE podlist_pod_age_seconds gauge
+podlist_pod_age_seconds{namespace="default",pod="api"} 60
+podlist_pod_age_seconds{namespace="default",pod="web"} 3600
+# HELP podlist_pod_containers Number of containers in the pod
+# TYPE podlist_pod_containers gauge
+podlist_pod_containers{namespace="default",pod="api"} 1
+podlist_pod_containers{namespace="default",pod="web"} 1
+# HELP podlist_pod_containers_ready Number of the pod's containers that are ready
+# TYPE podlist_pod_containers_ready gauge
+podlist_pod_containers_ready{namespace="default",pod="api"} 0
+podlist_pod_containers_ready{namespace="default",pod="web"} 1
+# HELP podlist_pod_count Number of pods in the cache
+# TYPE podlist_pod_count gauge
+podlist_pod_count 3
+# HELP podlist_pod_metrics_dropped Number of pods left out of the per pod metrics because of the limit
+# TYPE podlist_pod_metrics_dropped gauge
+podlist_pod_metrics_dropped 1
+# HELP podlist_pod_restarts_total Number of times the pod's containers have restarted
+# TYPE podlist_pod_restarts_total counter
+podlist_pod_restarts_total{namespace="default",pod="api"} 0
+podlist_pod_restarts_total{namespace="default",pod="web"} 3
+# HELP podlist_pods Number of pods by namespace and phase
+# TYPE podlist_pods gauge
+podlist_pods{namespace="default",phase="Failed"} 0
+podlist_pods{namespace="default",phase="Pending"} 1
+podlist_pods{namespace="default",phase="Running"} 1
+podlist_pods{namespace="default",phase="Succeeded"} 0
+podlist_pods{namespace="default",phase="Unknown"} 0
+podlist_pods{namespace="kube-system",phase="Failed"} 0
+podlist_pods{namespace="kube-system",phase="Pending"} 0
+podlist_pods{namespace="kube-system",phase="Running"} 1
+podlist_pods{namespace="kube-system",phase="Succeeded"} 0
+podlist_pods{namespace="kube-system",phase="Unknown"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing is reported until the cache has synced
+	client.Synced = false
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("expected no metrics before the cache synced, got %d", count)
+	}
+}
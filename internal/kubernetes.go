@@ -2,28 +2,61 @@ package internal
 
 import (
 	"context"
-	"io/ioutil"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/rs/zerolog"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 type (
-	ObjectMeta        = metav1.ObjectMeta
-	Time              = metav1.Time
-	Pod               = v1.Pod
-	PodStatus         = v1.PodStatus
-	ContainerStatuses = v1.ContainerStatus
-	PodList           = v1.PodList
-	Result            = rest.Result
+	ObjectMeta               = metav1.ObjectMeta
+	Time                     = metav1.Time
+	OwnerReference           = metav1.OwnerReference
+	Pod                      = v1.Pod
+	PodStatus                = v1.PodStatus
+	ContainerStatuses        = v1.ContainerStatus
+	PodSpec                  = v1.PodSpec
+	Container                = v1.Container
+	ContainerState           = v1.ContainerState
+	ContainerStateWaiting    = v1.ContainerStateWaiting
+	ContainerStateRunning    = v1.ContainerStateRunning
+	ContainerStateTerminated = v1.ContainerStateTerminated
+	PodCondition             = v1.PodCondition
+	PodList                  = v1.PodList
+	Result                   = rest.Result
 )
 
+// AllNamespaces configures the client to list pods cluster wide. This needs a
+// ClusterRole that allows listing and watching pods.
+const AllNamespaces = "*"
+
+// ErrNamespaceNotAllowed is returned when pods are requested from a namespace
+// outside of the configured allow-list
+var ErrNamespaceNotAllowed = errors.New("namespace is not allowed")
+
+// podResyncPeriod is how often the informer replays every cached pod to its
+// handlers. The cache itself is kept current by the watch, this is only a
+// safety net.
+const podResyncPeriod = 10 * time.Minute
+
 type ControlPlaneClient interface {
-	ListPods(ctx context.Context) (*v1.PodList, error)
+	ListPods(ctx context.Context, opts PodListOptions) (*v1.PodList, error)
 	Healthz(ctx context.Context) Result
+	CheckPermissions(ctx context.Context) error
+	CacheSynced() bool
+	WatchPods(ctx context.Context, opts PodListOptions, lastEventID string) (*PodWatch, error)
+	CachedPods() ([]*Pod, error)
 }
 
 // MockKubernetesClient is a mock implementation of KubernetesClient. It's used
@@ -31,40 +64,451 @@ type ControlPlaneClient interface {
 type MockKubernetesClient struct {
 	PodList *PodList
 	Error   error
+	Synced  bool
+
+	// PermissionsError is returned by CheckPermissions
+	PermissionsError error
+
+	// Namespaces is the allow-list of namespaces, nil allows every namespace
+	Namespaces []string
+
+	// Events is handed to every watcher as is, it's up to the test to only
+	// send events matching the watch
+	Events chan PodEvent
 }
 
-func (m *MockKubernetesClient) ListPods(ctx context.Context) (*PodList, error) {
-	return m.PodList, m.Error
+func (m *MockKubernetesClient) ListPods(ctx context.Context, opts PodListOptions) (*PodList, error) {
+	if opts.Namespace != "" && m.Namespaces != nil && !contains(m.Namespaces, opts.Namespace) {
+		return nil, ErrNamespaceNotAllowed
+	}
+
+	if m.PodList == nil {
+		return m.PodList, m.Error
+	}
+
+	items := []Pod{}
+	for i := range m.PodList.Items {
+		if opts.matchesWithNamespace(&m.PodList.Items[i]) {
+			items = append(items, m.PodList.Items[i])
+		}
+	}
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	return paginatePods(items, opts.Limit, opts.Continue)
 }
 
 func (m *MockKubernetesClient) Healthz(ctx context.Context) Result {
 	return Result{}
 }
 
-// Real implementation of a Kubernetes client
+func (m *MockKubernetesClient) CheckPermissions(ctx context.Context) error {
+	return m.PermissionsError
+}
+
+func (m *MockKubernetesClient) CacheSynced() bool {
+	return m.Synced
+}
+
+func (m *MockKubernetesClient) WatchPods(ctx context.Context, opts PodListOptions, lastEventID string) (*PodWatch, error) {
+	opts.Limit, opts.Continue = 0, ""
+	podList, err := m.ListPods(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	watch := &PodWatch{Snapshot: true, Events: m.Events}
+	for i := range podList.Items {
+		watch.Initial = append(watch.Initial, PodEvent{Type: PodAdded, Pod: &podList.Items[i]})
+	}
+	return watch, nil
+}
+
+func (m *MockKubernetesClient) CachedPods() ([]*Pod, error) {
+	if !m.Synced {
+		return nil, ErrCacheNotSynced
+	}
+	if m.PodList == nil {
+		return nil, m.Error
+	}
+
+	pods := make([]*Pod, len(m.PodList.Items))
+	for i := range m.PodList.Items {
+		pods[i] = &m.PodList.Items[i]
+	}
+	return pods, nil
+}
+
+// Real implementation of a Kubernetes client. Pods are served from shared
+// informer caches once they have synced so that we don't issue a List against
+// the API server on every request.
 type KubernetesClient struct {
 	log       zerolog.Logger
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
+
+	// namespaces is the allow-list of namespaces, or nil when listing pods
+	// cluster wide
+	namespaces []string
+
+	// There's one informer per namespace since an informer can only be scoped
+	// to a single namespace, or a single one keyed by metav1.NamespaceAll when
+	// listing cluster wide
+	informerFactories []informers.SharedInformerFactory
+	podListers        map[string]listersv1.PodLister
+	podsSynced        []cache.InformerSynced
+
+	broadcaster *podBroadcaster
+}
+
+// KubernetesClientOption lets you functionally control construction of the
+// Kubernetes client
+type KubernetesClientOption func(c *kubernetesClientConfig)
+
+type kubernetesClientConfig struct {
+	kubeconfig  string
+	kubeContext string
+	namespaces  []string
+	metrics     MetricsClient
 }
 
-func NewKubernetesClient(log zerolog.Logger) *KubernetesClient {
-	cfg, _ := rest.InClusterConfig()
-	clientset, _ := kubernetes.NewForConfig(cfg)
+// WithMetrics records the requests made to the API server
+func WithMetrics(metrics MetricsClient) KubernetesClientOption {
+	return func(c *kubernetesClientConfig) {
+		c.metrics = metrics
+	}
+}
 
-	return &KubernetesClient{
-		log:       log,
-		clientset: clientset,
+// WithKubeconfig loads credentials from a kubeconfig file instead of the
+// default loading rules ($KUBECONFIG, ~/.kube/config, then in-cluster)
+func WithKubeconfig(path string) KubernetesClientOption {
+	return func(c *kubernetesClientConfig) {
+		c.kubeconfig = path
 	}
 }
 
-func (k *KubernetesClient) ListPods(ctx context.Context) (*PodList, error) {
-	namespace, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+// WithKubeContext selects a context from the kubeconfig other than its
+// current-context
+func WithKubeContext(name string) KubernetesClientOption {
+	return func(c *kubernetesClientConfig) {
+		c.kubeContext = name
+	}
+}
+
+// WithNamespaces sets the namespaces to list pods from. Without it the
+// namespace of the kubeconfig context, or of the pod's own service account
+// when running in a cluster, is used. AllNamespaces lists pods cluster wide.
+func WithNamespaces(namespaces []string) KubernetesClientOption {
+	return func(c *kubernetesClientConfig) {
+		c.namespaces = namespaces
+	}
+}
+
+// NewKubernetesClient creates a client from a kubeconfig when one is
+// available, falling back to the in-cluster service account
+func NewKubernetesClient(log zerolog.Logger, options ...KubernetesClientOption) (*KubernetesClient, error) {
+	c := &kubernetesClientConfig{metrics: &NoopMetrics{}}
+	for _, option := range options {
+		option(c)
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = c.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: c.kubeContext},
+	)
+
+	cfg, err := clientConfig.ClientConfig()
 	if err != nil {
-		k.log.Fatal().Err(err).Msg("Failed to read namespace")
+		if clientcmd.IsEmptyConfig(err) {
+			return nil, errors.New("no Kubernetes configuration found: run inside a cluster, set $KUBECONFIG or pass --kubeconfig")
+		}
+		return nil, fmt.Errorf("failed to load Kubernetes configuration: %w", err)
 	}
-	return k.clientset.CoreV1().Pods(string(namespace)).List(ctx, metav1.ListOptions{})
+
+	cfg.Wrap(newAPIServerMetrics(c.metrics).wrap)
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	namespaces := c.namespaces
+	if len(namespaces) == 0 {
+		namespace, _, err := clientConfig.Namespace()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine namespace: %w", err)
+		}
+		namespaces = []string{namespace}
+	}
+
+	log.Info().Str("host", cfg.Host).Strs("namespaces", namespaces).Msg("Connecting to Kubernetes")
+	return newKubernetesClient(log, clientset, namespaces), nil
+}
+
+func newKubernetesClient(log zerolog.Logger, clientset kubernetes.Interface, namespaces []string) *KubernetesClient {
+	k := &KubernetesClient{
+		log:        log,
+		clientset:  clientset,
+		namespaces: namespaces,
+		podListers: map[string]listersv1.PodLister{},
+
+		broadcaster: newPodBroadcaster(),
+	}
+
+	informerNamespaces := namespaces
+	if contains(namespaces, AllNamespaces) {
+		k.namespaces = nil
+		informerNamespaces = []string{metav1.NamespaceAll}
+	}
+
+	for _, namespace := range informerNamespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(
+			clientset,
+			podResyncPeriod,
+			informers.WithNamespace(namespace),
+		)
+		podInformer := factory.Core().V1().Pods()
+		podInformer.Informer().AddEventHandler(k.broadcaster.handler())
+
+		k.informerFactories = append(k.informerFactories, factory)
+		k.podListers[namespace] = podInformer.Lister()
+		k.podsSynced = append(k.podsSynced, podInformer.Informer().HasSynced)
+	}
+
+	return k
+}
+
+// Start runs the pod informers in the background until stopCh is closed. It
+// doesn't wait for the caches to sync, ListPods falls back to the API server
+// until they have.
+func (k *KubernetesClient) Start(stopCh <-chan struct{}) {
+	for _, factory := range k.informerFactories {
+		factory.Start(stopCh)
+	}
+	go func() {
+		if cache.WaitForCacheSync(stopCh, k.podsSynced...) {
+			k.log.Info().Strs("namespaces", k.namespaces).Msg("Pod cache synced")
+		}
+	}()
+}
+
+// CacheSynced reports whether every pod informer has completed its initial list
+func (k *KubernetesClient) CacheSynced() bool {
+	for _, synced := range k.podsSynced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// CachedPods returns every pod in the cache without copying them, callers must
+// not modify them. Unlike ListPods it never goes to the API server, so it's
+// cheap enough to call on every metrics scrape.
+func (k *KubernetesClient) CachedPods() ([]*Pod, error) {
+	if !k.CacheSynced() {
+		return nil, ErrCacheNotSynced
+	}
+
+	var pods []*Pod
+	for _, lister := range k.podListers {
+		namespacePods, err := lister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, namespacePods...)
+	}
+	return pods, nil
+}
+
+// listScope returns the namespaces a request covers, metav1.NamespaceAll
+// meaning every namespace in the cluster
+func (k *KubernetesClient) listScope(namespace string) ([]string, error) {
+	if namespace == "" {
+		if k.namespaces == nil {
+			return []string{metav1.NamespaceAll}, nil
+		}
+		return k.namespaces, nil
+	}
+
+	if k.namespaces != nil && !contains(k.namespaces, namespace) {
+		return nil, ErrNamespaceNotAllowed
+	}
+	return []string{namespace}, nil
+}
+
+func (k *KubernetesClient) ListPods(ctx context.Context, opts PodListOptions) (*PodList, error) {
+	namespaces, err := k.listScope(opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// A continue token issued by the API server has to be followed up by the
+	// API server, even if the cache has synced in the meantime. A single
+	// namespace can also be paginated by the API server before the cache is
+	// ready.
+	apiContinue := opts.Continue != "" && !isCacheContinue(opts.Continue)
+	if apiContinue || (!k.CacheSynced() && opts.Continue == "" && len(namespaces) == 1 && opts.Filter == nil) {
+		k.log.Debug().Msg("Pod cache not synced, listing pods from the API server")
+		return k.clientset.CoreV1().Pods(namespaces[0]).List(ctx, metav1.ListOptions{
+			LabelSelector: opts.labelSelector().String(),
+			FieldSelector: opts.fieldSelector().String(),
+			Limit:         opts.Limit,
+			Continue:      opts.Continue,
+		})
+	}
+
+	var items []Pod
+	for _, namespace := range namespaces {
+		var pods []Pod
+		if k.CacheSynced() {
+			pods, err = k.listCachedPods(namespace, opts)
+		} else {
+			pods, err = k.listLivePods(ctx, namespace, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, pods...)
+	}
+	return paginatePods(items, opts.Limit, opts.Continue)
+}
+
+// WatchPods streams changes to pods from the cache. Passing the ID of the last
+// event a watcher saw resumes from there if it's recent enough, otherwise the
+// watch starts with a snapshot of every pod.
+func (k *KubernetesClient) WatchPods(ctx context.Context, opts PodListOptions, lastEventID string) (*PodWatch, error) {
+	namespaces, err := k.listScope(opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !k.CacheSynced() {
+		return nil, ErrCacheNotSynced
+	}
+
+	watch, w, err := k.broadcaster.subscribe(opts, lastEventID, func() ([]Pod, error) {
+		var items []Pod
+		for _, namespace := range namespaces {
+			pods, err := k.listCachedPods(namespace, opts)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, pods...)
+		}
+		podList, err := paginatePods(items, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		return podList.Items, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		k.broadcaster.unsubscribe(w)
+	}()
+	return watch, nil
+}
+
+func (k *KubernetesClient) listCachedPods(namespace string, opts PodListOptions) ([]Pod, error) {
+	lister, ok := k.podListers[namespace]
+	if !ok {
+		lister = k.podListers[metav1.NamespaceAll]
+	}
+
+	var pods []*Pod
+	var err error
+	if namespace == metav1.NamespaceAll {
+		pods, err = lister.List(opts.labelSelector())
+	} else {
+		pods, err = lister.Pods(namespace).List(opts.labelSelector())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects in the cache are shared, so callers get copies they're free to
+	// modify
+	items := make([]Pod, 0, len(pods))
+	for _, p := range pods {
+		if !opts.Matches(p) {
+			continue
+		}
+		items = append(items, *p.DeepCopy())
+	}
+	return items, nil
+}
+
+func (k *KubernetesClient) listLivePods(ctx context.Context, namespace string, opts PodListOptions) ([]Pod, error) {
+	k.log.Debug().Str("namespace", namespace).Msg("Pod cache not synced, listing pods from the API server")
+	podList, err := k.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: opts.labelSelector().String(),
+		FieldSelector: opts.fieldSelector().String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := podList.Items[:0]
+	for i := range podList.Items {
+		if opts.Filter == nil || opts.Filter(&podList.Items[i]) {
+			items = append(items, podList.Items[i])
+		}
+	}
+	return items, nil
 }
 
 func (k *KubernetesClient) Healthz(ctx context.Context) Result {
 	return k.clientset.Discovery().RESTClient().Get().AbsPath("/healthz").Do(ctx)
 }
+
+// podVerbs are what the informers, and the live List they fall back to, need
+// to be allowed to do with pods
+var podVerbs = []string{"list", "watch"}
+
+// CheckPermissions asks the API server whether we're still allowed to list and
+// watch pods in every namespace we serve, so that a removed RoleBinding shows
+// up before requests start failing
+func (k *KubernetesClient) CheckPermissions(ctx context.Context) error {
+	namespaces := k.namespaces
+	if namespaces == nil {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	for _, namespace := range namespaces {
+		for _, verb := range podVerbs {
+			review, err := k.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace: namespace,
+						Verb:      verb,
+						Resource:  "pods",
+					},
+				},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to review access to pods: %w", err)
+			}
+			if !review.Status.Allowed {
+				scope := fmt.Sprintf("in namespace %q", namespace)
+				if namespace == metav1.NamespaceAll {
+					scope = "cluster wide"
+				}
+				return fmt.Errorf("not allowed to %s pods %s", verb, scope)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
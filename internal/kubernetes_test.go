@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_ListPods(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&Pod{ObjectMeta: ObjectMeta{Name: "AAA", Namespace: "default"}},
+		&Pod{ObjectMeta: ObjectMeta{Name: "BBB", Namespace: "default"}},
+		&Pod{ObjectMeta: ObjectMeta{Name: "CCC", Namespace: "other"}},
+	)
+	k := newKubernetesClient(zerolog.New(ioutil.Discard), clientset, []string{"default"})
+
+	// Before the informer runs we should fall back to a live List
+	if k.CacheSynced() {
+		t.Fatal("expected cache to not be synced before Start")
+	}
+	podList, err := k.ListPods(context.Background(), PodListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing pods from the API server: %v", err)
+	}
+	if len(podList.Items) != 2 {
+		t.Errorf("expected 2 pods from the API server, got %d", len(podList.Items))
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	k.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, k.podsSynced...) {
+		t.Fatal("pod cache never synced")
+	}
+
+	// Once synced, the API server shouldn't be listed again
+	clientset.ClearActions()
+	podList, err = k.ListPods(context.Background(), PodListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error listing pods from the cache: %v", err)
+	}
+	if len(podList.Items) != 2 {
+		t.Errorf("expected 2 pods from the cache, got %d", len(podList.Items))
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "list" {
+			t.Errorf("expected pods to be served from the cache, got %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+func Test_ListPodsNamespaces(t *testing.T) {
+	type test struct {
+		name          string
+		namespaces    []string
+		namespace     string
+		expectedCount int
+		expectedErr   error
+	}
+
+	tests := []test{
+		{
+			name:          "Every configured namespace by default",
+			namespaces:    []string{"default", "other"},
+			expectedCount: 3,
+		},
+		{
+			name:          "A single configured namespace",
+			namespaces:    []string{"default", "other"},
+			namespace:     "other",
+			expectedCount: 1,
+		},
+		{
+			name:        "A namespace outside of the allow-list",
+			namespaces:  []string{"default", "other"},
+			namespace:   "kube-system",
+			expectedErr: ErrNamespaceNotAllowed,
+		},
+		{
+			name:          "Every namespace in the cluster",
+			namespaces:    []string{AllNamespaces},
+			expectedCount: 4,
+		},
+		{
+			name:          "Any namespace in the cluster",
+			namespaces:    []string{AllNamespaces},
+			namespace:     "kube-system",
+			expectedCount: 1,
+		},
+	}
+
+	for _, test := range tests {
+		clientset := fake.NewSimpleClientset(
+			&Pod{ObjectMeta: ObjectMeta{Name: "AAA", Namespace: "default"}},
+			&Pod{ObjectMeta: ObjectMeta{Name: "BBB", Namespace: "default"}},
+			&Pod{ObjectMeta: ObjectMeta{Name: "CCC", Namespace: "other"}},
+			&Pod{ObjectMeta: ObjectMeta{Name: "DDD", Namespace: "kube-system"}},
+		)
+		k := newKubernetesClient(zerolog.New(ioutil.Discard), clientset, test.namespaces)
+
+		// Both the live fallback and the cache should agree
+		stopCh := make(chan struct{})
+		for _, synced := range []bool{false, true} {
+			if synced {
+				k.Start(stopCh)
+				if !cache.WaitForCacheSync(stopCh, k.podsSynced...) {
+					t.Fatalf("%s: pod cache never synced", test.name)
+				}
+			}
+
+			podList, err := k.ListPods(context.Background(), PodListOptions{Namespace: test.namespace})
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("%s (synced=%t): expected error %v, got %v", test.name, synced, test.expectedErr, err)
+				continue
+			}
+			if err == nil && len(podList.Items) != test.expectedCount {
+				t.Errorf("%s (synced=%t): expected %d pods, got %d", test.name, synced, test.expectedCount, len(podList.Items))
+			}
+		}
+		close(stopCh)
+	}
+}
+
+func Test_CheckPermissions(t *testing.T) {
+	type test struct {
+		name        string
+		namespaces  []string
+		expectedErr string
+	}
+
+	tests := []test{
+		{name: "allowed", namespaces: []string{"default", "other"}},
+		{name: "one namespace denied", namespaces: []string{"default", "kube-system"}, expectedErr: `not allowed to list pods in namespace "kube-system"`},
+		{name: "cluster wide denied", namespaces: nil, expectedErr: "not allowed to watch pods cluster wide"},
+	}
+
+	for _, test := range tests {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+			switch {
+			case attributes.Namespace == "kube-system":
+			case attributes.Namespace == "" && attributes.Verb == "watch":
+			default:
+				review.Status.Allowed = true
+			}
+			return true, review, nil
+		})
+		k := newKubernetesClient(zerolog.New(ioutil.Discard), clientset, test.namespaces)
+
+		err := k.CheckPermissions(context.Background())
+		if (err == nil && test.expectedErr != "") || (err != nil && err.Error() != test.expectedErr) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.expectedErr, err)
+		}
+	}
+}
+
+func Test_NewKubernetesClientKubeconfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	ioutil.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    namespace: dev-namespace
+- name: prod
+  context:
+    cluster: prod
+    namespace: prod-namespace
+`), 0o600)
+
+	type test struct {
+		name               string
+		options            []KubernetesClientOption
+		expectedNamespaces []string
+		expectErr          bool
+	}
+
+	tests := []test{
+		{
+			name:               "Current context",
+			options:            []KubernetesClientOption{WithKubeconfig(kubeconfig)},
+			expectedNamespaces: []string{"dev-namespace"},
+		},
+		{
+			name:               "Explicit context",
+			options:            []KubernetesClientOption{WithKubeconfig(kubeconfig), WithKubeContext("prod")},
+			expectedNamespaces: []string{"prod-namespace"},
+		},
+		{
+			name:               "Explicit namespaces",
+			options:            []KubernetesClientOption{WithKubeconfig(kubeconfig), WithNamespaces([]string{"a", "b"})},
+			expectedNamespaces: []string{"a", "b"},
+		},
+		{
+			name:      "Unknown context",
+			options:   []KubernetesClientOption{WithKubeconfig(kubeconfig), WithKubeContext("missing")},
+			expectErr: true,
+		},
+		{
+			name:      "Missing kubeconfig",
+			options:   []KubernetesClientOption{WithKubeconfig(filepath.Join(t.TempDir(), "missing"))},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		k, err := NewKubernetesClient(zerolog.New(ioutil.Discard), test.options...)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(k.namespaces, test.expectedNamespaces) {
+			t.Errorf("%s: expected namespaces %v, got %v", test.name, test.expectedNamespaces, k.namespaces)
+		}
+	}
+}
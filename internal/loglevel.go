@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LogLevel decides which log lines get written, and can be changed while
+// running. Loggers from Logger check it before an event is built, so lines
+// below the level cost next to nothing. It's checked by the logger's sampler
+// rather than with zerolog's global level, since the global level can't be
+// lowered for a single logger, like one for a request that asked to be
+// debugged.
+type LogLevel struct {
+	level int32
+
+	mu           sync.Mutex
+	defaultLevel zerolog.Level
+	revert       *time.Timer
+	revertAt     time.Time
+}
+
+// NewLogLevel starts at level until it's changed
+func NewLogLevel(level zerolog.Level) *LogLevel {
+	return &LogLevel{level: int32(level), defaultLevel: level}
+}
+
+// Level returns the current level, the level it goes back to and when it does
+// so. revertAt is zero when the level isn't temporary.
+func (l *LogLevel) Level() (level, defaultLevel zerolog.Level, revertAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return zerolog.Level(atomic.LoadInt32(&l.level)), l.defaultLevel, l.revertAt
+}
+
+// Set changes the level. With a revertAfter it goes back to the default level
+// once that much time has passed, otherwise it stays until it's set again.
+func (l *LogLevel) Set(level zerolog.Level, revertAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopRevert()
+	atomic.StoreInt32(&l.level, int32(level))
+	if revertAfter > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(revertAfter, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			// The level was Set again while this was waiting for the lock
+			if l.revert != timer {
+				return
+			}
+			l.revert, l.revertAt = nil, time.Time{}
+			atomic.StoreInt32(&l.level, int32(l.defaultLevel))
+		})
+		l.revert, l.revertAt = timer, time.Now().Add(revertAfter)
+	}
+}
+
+// SetDefault changes the level that temporary levels go back to. The current
+// level follows along unless it has been Set to something else.
+func (l *LogLevel) SetDefault(level zerolog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if zerolog.Level(atomic.LoadInt32(&l.level)) == l.defaultLevel {
+		atomic.StoreInt32(&l.level, int32(level))
+	}
+	l.defaultLevel = level
+}
+
+func (l *LogLevel) stopRevert() {
+	if l.revert != nil {
+		l.revert.Stop()
+		l.revert, l.revertAt = nil, time.Time{}
+	}
+}
+
+// Logger writes the lines that are at or above the current level to out.
+// Loggers made from it with Sample(nil) write every line instead.
+func (l *LogLevel) Logger(out io.Writer) zerolog.Logger {
+	return zerolog.New(out).Sample(&levelSampler{level: &l.level})
+}
+
+type levelSampler struct {
+	level *int32
+}
+
+// Sample drops events below the level, zerolog doesn't build them at all then
+func (s *levelSampler) Sample(level zerolog.Level) bool {
+	return level == zerolog.NoLevel || level >= zerolog.Level(atomic.LoadInt32(s.level))
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func Test_LogLevelLogger(t *testing.T) {
+	var out bytes.Buffer
+	l := NewLogLevel(zerolog.InfoLevel)
+	log := l.Logger(&out)
+	debugLog := log.Sample(nil).Level(zerolog.DebugLevel)
+
+	// Events below the level aren't even built
+	if log.Debug().Enabled() {
+		t.Errorf("expected debug events to be disabled at info")
+	}
+	log.Debug().Msg("dropped")
+	log.Info().Msg("written")
+	log.Log().Msg("no level")
+	debugLog.Debug().Msg("debugging")
+
+	l.Set(zerolog.DebugLevel, 0)
+	log.Debug().Msg("now written")
+	l.Set(zerolog.ErrorLevel, 0)
+	log.Warn().Msg("dropped too")
+	subLog := log.With().Str("sub", "logger").Logger()
+	subLog.Warn().Msg("dropped as well")
+
+	expected := `{"level":"info","message":"written"}
+{"message":"no level"}
+{"level":"debug","message":"debugging"}
+{"level":"debug","message":"now written"}
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func Test_LogLevelRevert(t *testing.T) {
+	l := NewLogLevel(zerolog.InfoLevel)
+
+	l.Set(zerolog.DebugLevel, 50*time.Millisecond)
+	level, defaultLevel, revertAt := l.Level()
+	if level != zerolog.DebugLevel || defaultLevel != zerolog.InfoLevel || revertAt.IsZero() {
+		t.Errorf("expected debug until it reverts to info, got %s, %s, %s", level, defaultLevel, revertAt)
+	}
+
+	// Setting the level again cancels the revert
+	l.Set(zerolog.WarnLevel, 0)
+	time.Sleep(100 * time.Millisecond)
+	if level, _, revertAt := l.Level(); level != zerolog.WarnLevel || !revertAt.IsZero() {
+		t.Errorf("expected warn for good, got %s until %s", level, revertAt)
+	}
+
+	l.Set(zerolog.DebugLevel, 50*time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for level, _, _ := l.Level(); level != zerolog.InfoLevel; level, _, _ = l.Level() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the level to revert to info, still %s", level)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_LogLevelSetDefault(t *testing.T) {
+	l := NewLogLevel(zerolog.InfoLevel)
+
+	// The level follows the default while it hasn't been changed
+	l.SetDefault(zerolog.DebugLevel)
+	if level, defaultLevel, _ := l.Level(); level != zerolog.DebugLevel || defaultLevel != zerolog.DebugLevel {
+		t.Errorf("expected debug, got %s with default %s", level, defaultLevel)
+	}
+
+	// but a level that was set is left alone
+	l.Set(zerolog.ErrorLevel, time.Hour)
+	l.SetDefault(zerolog.InfoLevel)
+	if level, defaultLevel, _ := l.Level(); level != zerolog.ErrorLevel || defaultLevel != zerolog.InfoLevel {
+		t.Errorf("expected error with default info, got %s with default %s", level, defaultLevel)
+	}
+}
@@ -6,13 +6,25 @@ import (
 )
 
 type (
-	Gauge     = prometheus.Gauge
-	GaugeOpts = prometheus.GaugeOpts
+	Gauge         = prometheus.Gauge
+	GaugeOpts     = prometheus.GaugeOpts
+	GaugeVec      = prometheus.GaugeVec
+	Counter       = prometheus.Counter
+	CounterOpts   = prometheus.CounterOpts
+	CounterVec    = prometheus.CounterVec
+	Histogram     = prometheus.Histogram
+	HistogramOpts = prometheus.HistogramOpts
+	HistogramVec  = prometheus.HistogramVec
 )
 
 // MetricsClient is a prometheus metrics client
 type MetricsClient interface {
 	NewGauge(opts prometheus.GaugeOpts) Gauge
+	NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *GaugeVec
+	NewCounter(opts prometheus.CounterOpts) Counter
+	NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *CounterVec
+	NewHistogram(opts prometheus.HistogramOpts) Histogram
+	NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *HistogramVec
 }
 
 // NoopMetrics is an empty metrics client that doesn't register to any metrics collector
@@ -23,10 +35,71 @@ func (n *NoopMetrics) NewGauge(opts prometheus.GaugeOpts) Gauge {
 	return prometheus.NewGauge(opts)
 }
 
+// NewGaugeVec will create a prometheus gauge vector but will not register it
+func (n *NoopMetrics) NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *GaugeVec {
+	return prometheus.NewGaugeVec(opts, labelNames)
+}
+
+// NewCounter will create a prometheus counter but will not register it
+func (n *NoopMetrics) NewCounter(opts prometheus.CounterOpts) Counter {
+	return prometheus.NewCounter(opts)
+}
+
+// NewCounterVec will create a prometheus counter vector but will not register it
+func (n *NoopMetrics) NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *CounterVec {
+	return prometheus.NewCounterVec(opts, labelNames)
+}
+
+// NewHistogram will create a prometheus histogram but will not register it
+func (n *NoopMetrics) NewHistogram(opts prometheus.HistogramOpts) Histogram {
+	return prometheus.NewHistogram(opts)
+}
+
+// NewHistogramVec will create a prometheus histogram vector but will not register it
+func (n *NoopMetrics) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *HistogramVec {
+	return prometheus.NewHistogramVec(opts, labelNames)
+}
+
 // PrometheusMetrics represents a prometheus metrics client
-type PrometheusMetrics struct{}
+type PrometheusMetrics struct {
+	// Registerer is where metrics are registered, prometheus.DefaultRegisterer
+	// when it's nil
+	Registerer prometheus.Registerer
+}
 
-// NewGauge returns a new counter metric that's registered to the automatic prometheus collector
+func (p *PrometheusMetrics) factory() promauto.Factory {
+	if p.Registerer == nil {
+		return promauto.With(prometheus.DefaultRegisterer)
+	}
+	return promauto.With(p.Registerer)
+}
+
+// NewGauge returns a new counter metric that's registered to the Registerer
 func (p *PrometheusMetrics) NewGauge(opts prometheus.GaugeOpts) Gauge {
-	return promauto.NewGauge(opts)
+	return p.factory().NewGauge(opts)
+}
+
+// NewGaugeVec returns a new gauge vector that's registered to the Registerer
+func (p *PrometheusMetrics) NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *GaugeVec {
+	return p.factory().NewGaugeVec(opts, labelNames)
+}
+
+// NewCounter returns a new counter that's registered to the Registerer
+func (p *PrometheusMetrics) NewCounter(opts prometheus.CounterOpts) Counter {
+	return p.factory().NewCounter(opts)
+}
+
+// NewCounterVec returns a new counter vector that's registered to the Registerer
+func (p *PrometheusMetrics) NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *CounterVec {
+	return p.factory().NewCounterVec(opts, labelNames)
+}
+
+// NewHistogram returns a new histogram that's registered to the Registerer
+func (p *PrometheusMetrics) NewHistogram(opts prometheus.HistogramOpts) Histogram {
+	return p.factory().NewHistogram(opts)
+}
+
+// NewHistogramVec returns a new histogram vector that's registered to the Registerer
+func (p *PrometheusMetrics) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *HistogramVec {
+	return p.factory().NewHistogramVec(opts, labelNames)
 }
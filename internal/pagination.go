@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidContinue is returned when a continue token can't be decoded
+var ErrInvalidContinue = errors.New("invalid continue token")
+
+// cacheContinuePrefix marks continue tokens that we issued while serving from
+// the pod cache. The API server's own tokens are plain base64 and never
+// contain a '.', so anything else is handed to the API server untouched.
+const cacheContinuePrefix = "c."
+
+func isCacheContinue(token string) bool {
+	return strings.HasPrefix(token, cacheContinuePrefix)
+}
+
+// podKey is the namespace/name key pods are ordered by, the same order the API
+// server returns them in
+func podKey(p *Pod) string {
+	return p.Namespace + "/" + p.Name
+}
+
+func encodeCacheContinue(lastKey string) string {
+	return cacheContinuePrefix + base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+}
+
+func decodeCacheContinue(token string) (string, error) {
+	lastKey, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, cacheContinuePrefix))
+	if err != nil || !strings.Contains(string(lastKey), "/") {
+		return "", ErrInvalidContinue
+	}
+	return string(lastKey), nil
+}
+
+// paginatePods returns one page of pods in the same namespace/name order the
+// API server uses, along with the cursor and remaining count for the next
+// page. The items are sorted in place.
+func paginatePods(items []Pod, limit int64, token string) (*PodList, error) {
+	sort.Slice(items, func(i, j int) bool {
+		return podKey(&items[i]) < podKey(&items[j])
+	})
+
+	if token != "" {
+		lastKey, err := decodeCacheContinue(token)
+		if err != nil {
+			return nil, err
+		}
+		start := sort.Search(len(items), func(i int) bool {
+			return podKey(&items[i]) > lastKey
+		})
+		items = items[start:]
+	}
+
+	podList := &PodList{Items: items}
+	if limit <= 0 || int64(len(items)) <= limit {
+		return podList, nil
+	}
+
+	remaining := int64(len(items)) - limit
+	podList.Items = items[:limit]
+	podList.Continue = encodeCacheContinue(podKey(&items[limit-1]))
+	podList.RemainingItemCount = &remaining
+	return podList, nil
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// podSelectableFields are the pod fields the API server supports in a field
+// selector. We only accept these so that the cache and a live List agree on
+// what a selector means.
+var podSelectableFields = map[string]struct{}{
+	"metadata.name":            {},
+	"metadata.namespace":       {},
+	"spec.nodeName":            {},
+	"spec.restartPolicy":       {},
+	"spec.schedulerName":       {},
+	"spec.serviceAccountName":  {},
+	"status.phase":             {},
+	"status.podIP":             {},
+	"status.nominatedNodeName": {},
+}
+
+// PodListOptions narrows down the pods returned by ControlPlaneClient.ListPods
+type PodListOptions struct {
+	// Namespace limits the list to a single namespace, empty means every
+	// namespace the client is allowed to list
+	Namespace string
+
+	LabelSelector labels.Selector
+	FieldSelector fields.Selector
+
+	// Filter further narrows down pods on anything selectors can't express.
+	// The API server can't apply it, so a filtered list is always paginated
+	// by us.
+	Filter func(p *Pod) bool
+
+	// Limit is the maximum number of pods to return, 0 means no limit
+	Limit int64
+	// Continue is the cursor returned by a previous limited list
+	Continue string
+}
+
+// NewPodListOptions parses label and field selectors written in the same
+// syntax kubectl accepts. Empty selectors match every pod.
+func NewPodListOptions(labelSelector, fieldSelector string) (PodListOptions, error) {
+	ls, err := labels.Parse(labelSelector)
+	if err != nil {
+		return PodListOptions{}, fmt.Errorf("invalid labelSelector: %w", err)
+	}
+
+	fs, err := fields.ParseSelector(fieldSelector)
+	if err != nil {
+		return PodListOptions{}, fmt.Errorf("invalid fieldSelector: %w", err)
+	}
+	for _, r := range fs.Requirements() {
+		if _, ok := podSelectableFields[r.Field]; !ok {
+			return PodListOptions{}, fmt.Errorf("invalid fieldSelector: field %q is not supported for pods", r.Field)
+		}
+	}
+
+	return PodListOptions{
+		LabelSelector: ls,
+		FieldSelector: fs,
+	}, nil
+}
+
+// PodNameSelector is a field selector matching a single pod by name
+func PodNameSelector(name string) fields.Selector {
+	return fields.OneTermEqualSelector("metadata.name", name)
+}
+
+func (o PodListOptions) labelSelector() labels.Selector {
+	if o.LabelSelector == nil {
+		return labels.Everything()
+	}
+	return o.LabelSelector
+}
+
+func (o PodListOptions) fieldSelector() fields.Selector {
+	if o.FieldSelector == nil {
+		return fields.Everything()
+	}
+	return o.FieldSelector
+}
+
+// Matches reports whether a pod is selected by both selectors and the filter
+func (o PodListOptions) Matches(p *Pod) bool {
+	return o.labelSelector().Matches(labels.Set(p.Labels)) &&
+		o.fieldSelector().Matches(podFields(p)) &&
+		(o.Filter == nil || o.Filter(p))
+}
+
+func (o PodListOptions) matchesWithNamespace(p *Pod) bool {
+	if o.Namespace != "" && p.Namespace != o.Namespace {
+		return false
+	}
+	return o.Matches(p)
+}
+
+// podFields mirrors the field set the API server builds for pod field
+// selectors
+func podFields(p *Pod) fields.Set {
+	return fields.Set{
+		"metadata.name":            p.Name,
+		"metadata.namespace":       p.Namespace,
+		"spec.nodeName":            p.Spec.NodeName,
+		"spec.restartPolicy":       string(p.Spec.RestartPolicy),
+		"spec.schedulerName":       p.Spec.SchedulerName,
+		"spec.serviceAccountName":  p.Spec.ServiceAccountName,
+		"status.phase":             string(p.Status.Phase),
+		"status.podIP":             p.Status.PodIP,
+		"status.nominatedNodeName": p.Status.NominatedNodeName,
+	}
+}
@@ -0,0 +1,94 @@
+package internal
+
+import "fmt"
+
+// nodeUnreachablePodReason is set by the node controller on pods whose node
+// stopped reporting
+const nodeUnreachablePodReason = "NodeLost"
+
+// PodDisplayStatus computes the STATUS and READY columns of `kubectl get pods`
+// using the same rules as kubectl's printer. ready and total count the
+// pod's regular containers.
+func PodDisplayStatus(p *Pod) (status string, ready, total int) {
+	total = len(p.Spec.Containers)
+
+	status = string(p.Status.Phase)
+	if p.Status.Reason != "" {
+		status = p.Status.Reason
+	}
+
+	// The first init container that hasn't completed decides the status
+	initializing := false
+	for i, container := range p.Status.InitContainerStatuses {
+		switch {
+		case container.State.Terminated != nil && container.State.Terminated.ExitCode == 0:
+			continue
+		case container.State.Terminated != nil:
+			if container.State.Terminated.Reason == "" {
+				if container.State.Terminated.Signal != 0 {
+					status = fmt.Sprintf("Init:Signal:%d", container.State.Terminated.Signal)
+				} else {
+					status = fmt.Sprintf("Init:ExitCode:%d", container.State.Terminated.ExitCode)
+				}
+			} else {
+				status = "Init:" + container.State.Terminated.Reason
+			}
+		case container.State.Waiting != nil && container.State.Waiting.Reason != "" && container.State.Waiting.Reason != "PodInitializing":
+			status = "Init:" + container.State.Waiting.Reason
+		default:
+			status = fmt.Sprintf("Init:%d/%d", i, len(p.Spec.InitContainers))
+		}
+		initializing = true
+		break
+	}
+
+	if !initializing {
+		hasRunning := false
+		for i := len(p.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			container := p.Status.ContainerStatuses[i]
+
+			switch {
+			case container.State.Waiting != nil && container.State.Waiting.Reason != "":
+				status = container.State.Waiting.Reason
+			case container.State.Terminated != nil && container.State.Terminated.Reason != "":
+				status = container.State.Terminated.Reason
+			case container.State.Terminated != nil:
+				if container.State.Terminated.Signal != 0 {
+					status = fmt.Sprintf("Signal:%d", container.State.Terminated.Signal)
+				} else {
+					status = fmt.Sprintf("ExitCode:%d", container.State.Terminated.ExitCode)
+				}
+			case container.Ready && container.State.Running != nil:
+				hasRunning = true
+				ready++
+			}
+		}
+
+		// A pod with a completed container is still running as long as one of
+		// its containers is
+		if status == "Completed" && hasRunning {
+			if podReady(p) {
+				status = "Running"
+			} else {
+				status = "NotReady"
+			}
+		}
+	}
+
+	if p.DeletionTimestamp != nil && p.Status.Reason == nodeUnreachablePodReason {
+		status = "Unknown"
+	} else if p.DeletionTimestamp != nil {
+		status = "Terminating"
+	}
+
+	return status, ready, total
+}
+
+func podReady(p *Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == "Ready" && c.Status == "True" {
+			return true
+		}
+	}
+	return false
+}
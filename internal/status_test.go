@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func Test_PodDisplayStatus(t *testing.T) {
+	type test struct {
+		name           string
+		pod            Pod
+		expectedStatus string
+		expectedReady  int
+		expectedTotal  int
+	}
+
+	running := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	waiting := func(reason string) v1.ContainerState {
+		return v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}}
+	}
+	terminated := func(reason string, exitCode int32) v1.ContainerState {
+		return v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode}}
+	}
+	spec := func(initContainers, containers int) v1.PodSpec {
+		return v1.PodSpec{
+			InitContainers: make([]v1.Container, initContainers),
+			Containers:     make([]v1.Container, containers),
+		}
+	}
+	deletionTimestamp := &Time{Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []test{
+		{
+			name: "Running",
+			pod: Pod{
+				Spec: spec(0, 2),
+				Status: PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []ContainerStatuses{
+						{Ready: true, State: running},
+						{Ready: true, State: running},
+					},
+				},
+			},
+			expectedStatus: "Running",
+			expectedReady:  2,
+			expectedTotal:  2,
+		},
+		{
+			name: "Pending",
+			pod: Pod{
+				Spec:   spec(0, 1),
+				Status: PodStatus{Phase: v1.PodPending},
+			},
+			expectedStatus: "Pending",
+			expectedTotal:  1,
+		},
+		{
+			name: "CrashLoopBackOff",
+			pod: Pod{
+				Spec: spec(0, 2),
+				Status: PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []ContainerStatuses{
+						{State: waiting("CrashLoopBackOff")},
+						{Ready: true, State: running},
+					},
+				},
+			},
+			expectedStatus: "CrashLoopBackOff",
+			expectedReady:  1,
+			expectedTotal:  2,
+		},
+		{
+			name: "ImagePullBackOff",
+			pod: Pod{
+				Spec: spec(0, 1),
+				Status: PodStatus{
+					Phase:             v1.PodPending,
+					ContainerStatuses: []ContainerStatuses{{State: waiting("ImagePullBackOff")}},
+				},
+			},
+			expectedStatus: "ImagePullBackOff",
+			expectedTotal:  1,
+		},
+		{
+			name: "Completed",
+			pod: Pod{
+				Spec: spec(0, 1),
+				Status: PodStatus{
+					Phase:             v1.PodSucceeded,
+					ContainerStatuses: []ContainerStatuses{{State: terminated("Completed", 0)}},
+				},
+			},
+			expectedStatus: "Completed",
+			expectedTotal:  1,
+		},
+		{
+			name: "Completed container in a running pod that isn't ready",
+			pod: Pod{
+				Spec: spec(0, 2),
+				Status: PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []ContainerStatuses{
+						{State: terminated("Completed", 0)},
+						{Ready: true, State: running},
+					},
+				},
+			},
+			expectedStatus: "NotReady",
+			expectedReady:  1,
+			expectedTotal:  2,
+		},
+		{
+			name: "Terminated without a reason",
+			pod: Pod{
+				Spec: spec(0, 1),
+				Status: PodStatus{
+					Phase:             v1.PodFailed,
+					ContainerStatuses: []ContainerStatuses{{State: terminated("", 137)}},
+				},
+			},
+			expectedStatus: "ExitCode:137",
+			expectedTotal:  1,
+		},
+		{
+			name: "Waiting on the first init container",
+			pod: Pod{
+				Spec: spec(2, 1),
+				Status: PodStatus{
+					Phase: v1.PodPending,
+					InitContainerStatuses: []ContainerStatuses{
+						{State: running},
+						{State: waiting("PodInitializing")},
+					},
+				},
+			},
+			expectedStatus: "Init:0/2",
+			expectedTotal:  1,
+		},
+		{
+			name: "Waiting on the second init container",
+			pod: Pod{
+				Spec: spec(2, 1),
+				Status: PodStatus{
+					Phase: v1.PodPending,
+					InitContainerStatuses: []ContainerStatuses{
+						{State: terminated("Completed", 0)},
+						{State: running},
+					},
+				},
+			},
+			expectedStatus: "Init:1/2",
+			expectedTotal:  1,
+		},
+		{
+			name: "Crashing init container",
+			pod: Pod{
+				Spec: spec(1, 1),
+				Status: PodStatus{
+					Phase:                 v1.PodPending,
+					InitContainerStatuses: []ContainerStatuses{{State: waiting("CrashLoopBackOff")}},
+				},
+			},
+			expectedStatus: "Init:CrashLoopBackOff",
+			expectedTotal:  1,
+		},
+		{
+			name: "Failed init container",
+			pod: Pod{
+				Spec: spec(1, 1),
+				Status: PodStatus{
+					Phase:                 v1.PodPending,
+					InitContainerStatuses: []ContainerStatuses{{State: terminated("", 1)}},
+				},
+			},
+			expectedStatus: "Init:ExitCode:1",
+			expectedTotal:  1,
+		},
+		{
+			name: "Terminating",
+			pod: Pod{
+				ObjectMeta: ObjectMeta{DeletionTimestamp: deletionTimestamp},
+				Spec:       spec(0, 1),
+				Status: PodStatus{
+					Phase:             v1.PodRunning,
+					ContainerStatuses: []ContainerStatuses{{Ready: true, State: running}},
+				},
+			},
+			expectedStatus: "Terminating",
+			expectedReady:  1,
+			expectedTotal:  1,
+		},
+		{
+			name: "Node lost",
+			pod: Pod{
+				ObjectMeta: ObjectMeta{DeletionTimestamp: deletionTimestamp},
+				Spec:       spec(0, 1),
+				Status: PodStatus{
+					Phase:  v1.PodRunning,
+					Reason: "NodeLost",
+				},
+			},
+			expectedStatus: "Unknown",
+			expectedTotal:  1,
+		},
+		{
+			name: "Evicted",
+			pod: Pod{
+				Spec: spec(0, 1),
+				Status: PodStatus{
+					Phase:  v1.PodFailed,
+					Reason: "Evicted",
+				},
+			},
+			expectedStatus: "Evicted",
+			expectedTotal:  1,
+		},
+	}
+
+	for _, test := range tests {
+		status, ready, total := PodDisplayStatus(&test.pod)
+		if status != test.expectedStatus || ready != test.expectedReady || total != test.expectedTotal {
+			t.Errorf("%s: expected %s %d/%d, got %s %d/%d", test.name,
+				test.expectedStatus, test.expectedReady, test.expectedTotal,
+				status, ready, total)
+		}
+	}
+}
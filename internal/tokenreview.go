@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type UserInfo = authenticationv1.UserInfo
+
+// ErrTokenRejected is returned for tokens the API server didn't authenticate
+var ErrTokenRejected = errors.New("token rejected")
+
+// TokenReviewer authenticates bearer tokens
+type TokenReviewer interface {
+	ReviewToken(ctx context.Context, token string) (UserInfo, error)
+}
+
+// MockTokenReviewer authenticates the tokens in Users. It's used for testing.
+type MockTokenReviewer struct {
+	Users map[string]UserInfo
+	Error error
+
+	// Reviews counts the tokens that were reviewed
+	Reviews int
+}
+
+func (m *MockTokenReviewer) ReviewToken(ctx context.Context, token string) (UserInfo, error) {
+	m.Reviews++
+	if m.Error != nil {
+		return UserInfo{}, m.Error
+	}
+	user, ok := m.Users[token]
+	if !ok {
+		return UserInfo{}, ErrTokenRejected
+	}
+	return user, nil
+}
+
+// TokenReviewer authenticates tokens with the TokenReview API, the same way
+// the API server authenticates its own requests. This needs the
+// system:auth-delegator ClusterRole. Tokens have to be intended for one of
+// audiences, or for the API server when there are none.
+func (k *KubernetesClient) TokenReviewer(audiences []string) TokenReviewer {
+	return &apiTokenReviewer{clientset: k.clientset, audiences: audiences}
+}
+
+type apiTokenReviewer struct {
+	clientset kubernetes.Interface
+	audiences []string
+}
+
+func (r *apiTokenReviewer) ReviewToken(ctx context.Context, token string) (UserInfo, error) {
+	review, err := r.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: r.audiences,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("failed to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			return UserInfo{}, fmt.Errorf("%w: %s", ErrTokenRejected, review.Status.Error)
+		}
+		return UserInfo{}, ErrTokenRejected
+	}
+	return review.Status.User, nil
+}
+
+// maxCachedTokens and maxRejectedTokens bound the cache. Rejected tokens have
+// their own, smaller, limit so a client sending random tokens can only push
+// out other rejected tokens, never the users that were authenticated.
+const (
+	maxCachedTokens   = 10000
+	maxRejectedTokens = 1000
+)
+
+// sharedReviewTimeout bounds a review that's shared by concurrent requests,
+// each request still stops waiting when its own context is done
+const sharedReviewTimeout = 10 * time.Second
+
+// cachedTokenReviewer remembers the outcome of reviews so that a client
+// making many requests doesn't cost a TokenReview for each of them. Rejected
+// tokens are remembered too, failures to review a token aren't. Concurrent
+// requests with the same token that isn't cached yet share a single review.
+type cachedTokenReviewer struct {
+	reviewer TokenReviewer
+	ttl      time.Duration
+	clock    Clock
+	reviews  singleflight.Group
+
+	mu       sync.Mutex
+	accepted *reviewCache
+	rejected *reviewCache
+}
+
+// NewCachedTokenReviewer caches reviews for ttl. Tokens are only kept as
+// hashes.
+func NewCachedTokenReviewer(reviewer TokenReviewer, ttl time.Duration, clock Clock) TokenReviewer {
+	return &cachedTokenReviewer{
+		reviewer: reviewer,
+		ttl:      ttl,
+		clock:    clock,
+		accepted: newReviewCache(maxCachedTokens),
+		rejected: newReviewCache(maxRejectedTokens),
+	}
+}
+
+func (c *cachedTokenReviewer) ReviewToken(ctx context.Context, token string) (UserInfo, error) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	now := c.clock.Now()
+	cached, ok := c.accepted.get(key, now)
+	if !ok {
+		cached, ok = c.rejected.get(key, now)
+	}
+	c.mu.Unlock()
+	if ok {
+		return cached.user, cached.err
+	}
+
+	// The review isn't tied to the request that happened to start it, so a
+	// request that gives up doesn't fail the others waiting on it
+	result := c.reviews.DoChan(hex.EncodeToString(key[:]), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedReviewTimeout)
+		defer cancel()
+		return c.review(ctx, key, token)
+	})
+	select {
+	case res := <-result:
+		return res.Val.(UserInfo), res.Err
+	case <-ctx.Done():
+		return UserInfo{}, ctx.Err()
+	}
+}
+
+func (c *cachedTokenReviewer) review(ctx context.Context, key [sha256.Size]byte, token string) (UserInfo, error) {
+	user, err := c.reviewer.ReviewToken(ctx, token)
+	if err != nil && !errors.Is(err, ErrTokenRejected) {
+		return user, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	review := cachedReview{key: key, user: user, err: err, expires: now.Add(c.ttl)}
+	if err != nil {
+		c.rejected.add(review, now)
+	} else {
+		c.accepted.add(review, now)
+	}
+	return user, err
+}
+
+type cachedReview struct {
+	key     [sha256.Size]byte
+	user    UserInfo
+	err     error
+	expires time.Time
+}
+
+// reviewCache holds up to max reviews in the order they were added. Every
+// review lives for the same ttl, so that's also the order they expire in and
+// the oldest is evicted to make room.
+type reviewCache struct {
+	max     int
+	order   *list.List
+	reviews map[[sha256.Size]byte]*list.Element
+}
+
+func newReviewCache(max int) *reviewCache {
+	return &reviewCache{
+		max:     max,
+		order:   list.New(),
+		reviews: map[[sha256.Size]byte]*list.Element{},
+	}
+}
+
+func (c *reviewCache) get(key [sha256.Size]byte, now time.Time) (cachedReview, bool) {
+	e, ok := c.reviews[key]
+	if !ok {
+		return cachedReview{}, false
+	}
+	review := e.Value.(cachedReview)
+	return review, now.Before(review.expires)
+}
+
+func (c *reviewCache) add(review cachedReview, now time.Time) {
+	if e, ok := c.reviews[review.key]; ok {
+		c.remove(e)
+	}
+	for e := c.order.Front(); e != nil && !now.Before(e.Value.(cachedReview).expires); e = c.order.Front() {
+		c.remove(e)
+	}
+	for c.order.Len() >= c.max {
+		c.remove(c.order.Front())
+	}
+	c.reviews[review.key] = c.order.PushBack(review)
+}
+
+func (c *reviewCache) remove(e *list.Element) {
+	delete(c.reviews, e.Value.(cachedReview).key)
+	c.order.Remove(e)
+}
+
+func (c *reviewCache) len() int {
+	return c.order.Len()
+}
@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_TokenReviewer(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch review.Spec.Token {
+		case "alice-token":
+			if !reflect.DeepEqual(review.Spec.Audiences, []string{"podlist"}) {
+				review.Status.Error = "token audiences don't match"
+				break
+			}
+			review.Status.Authenticated = true
+			review.Status.User = UserInfo{Username: "alice", Groups: []string{"developers"}}
+		case "unreachable":
+			return true, nil, errors.New("connection refused")
+		}
+		return true, review, nil
+	})
+	reviewer := newKubernetesClient(zerolog.New(ioutil.Discard), clientset, nil).TokenReviewer([]string{"podlist"})
+
+	user, err := reviewer.ReviewToken(context.Background(), "alice-token")
+	if expected := (UserInfo{Username: "alice", Groups: []string{"developers"}}); err != nil || !reflect.DeepEqual(user, expected) {
+		t.Errorf("expected %+v, got %+v %v", expected, user, err)
+	}
+	if _, err := reviewer.ReviewToken(context.Background(), "guess"); !errors.Is(err, ErrTokenRejected) {
+		t.Errorf("expected the token to be rejected, got %v", err)
+	}
+	if _, err := reviewer.ReviewToken(context.Background(), "unreachable"); err == nil || errors.Is(err, ErrTokenRejected) {
+		t.Errorf("expected the review to fail, got %v", err)
+	}
+}
+
+func Test_CachedTokenReviewer(t *testing.T) {
+	mock := &MockTokenReviewer{Users: map[string]UserInfo{"alice-token": {Username: "alice"}}}
+	clock := &MockClock{Time: time.Now()}
+	reviewer := NewCachedTokenReviewer(mock, time.Minute, clock)
+
+	review := func(token string) (UserInfo, error) {
+		return reviewer.ReviewToken(context.Background(), token)
+	}
+
+	// Both users and rejections are cached
+	for i := 0; i < 3; i++ {
+		if user, err := review("alice-token"); err != nil || user.Username != "alice" {
+			t.Errorf("expected alice, got %+v %v", user, err)
+		}
+		if _, err := review("guess"); !errors.Is(err, ErrTokenRejected) {
+			t.Errorf("expected the token to be rejected, got %v", err)
+		}
+	}
+	if mock.Reviews != 2 {
+		t.Errorf("expected 2 reviews, got %d", mock.Reviews)
+	}
+
+	// Until they expire
+	clock.Time = clock.Time.Add(time.Minute)
+	review("alice-token")
+	if mock.Reviews != 3 {
+		t.Errorf("expected the expired token to be reviewed again, got %d reviews", mock.Reviews)
+	}
+
+	// Failed reviews aren't cached
+	mock.Error = errors.New("connection refused")
+	for i := 0; i < 2; i++ {
+		if _, err := review("bob-token"); err == nil || errors.Is(err, ErrTokenRejected) {
+			t.Errorf("expected the review to fail, got %v", err)
+		}
+	}
+	if mock.Reviews != 5 {
+		t.Errorf("expected failed reviews to be retried, got %d reviews", mock.Reviews)
+	}
+}
+
+// blockingReviewer holds every review until it's released
+type blockingReviewer struct {
+	reviews  int32
+	started  chan struct{}
+	released chan struct{}
+}
+
+func (b *blockingReviewer) ReviewToken(ctx context.Context, token string) (UserInfo, error) {
+	if atomic.AddInt32(&b.reviews, 1) == 1 {
+		close(b.started)
+	}
+	<-b.released
+	return UserInfo{Username: "alice"}, nil
+}
+
+func Test_CachedTokenReviewerConcurrent(t *testing.T) {
+	blocking := &blockingReviewer{started: make(chan struct{}), released: make(chan struct{})}
+	reviewer := NewCachedTokenReviewer(blocking, time.Minute, &MockClock{Time: time.Now()})
+
+	var wg sync.WaitGroup
+	users := make(chan UserInfo, 10)
+	for i := 0; i < cap(users); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := reviewer.ReviewToken(context.Background(), "alice-token")
+			if err != nil {
+				t.Errorf("expected alice, got %v", err)
+			}
+			users <- user
+		}()
+	}
+	<-blocking.started
+
+	// A request that gives up doesn't wait for the review, or cancel it for
+	// the others
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := reviewer.ReviewToken(ctx, "alice-token"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled request to give up, got %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(blocking.released)
+	wg.Wait()
+	close(users)
+
+	for user := range users {
+		if user.Username != "alice" {
+			t.Errorf("expected alice, got %+v", user)
+		}
+	}
+	if n := atomic.LoadInt32(&blocking.reviews); n != 1 {
+		t.Errorf("expected the requests to share 1 review, got %d", n)
+	}
+}
+
+func Test_CachedTokenReviewerFull(t *testing.T) {
+	mock := &MockTokenReviewer{Users: map[string]UserInfo{}}
+	for i := 0; i <= maxCachedTokens; i++ {
+		mock.Users[fmt.Sprintf("user-%d", i)] = UserInfo{Username: fmt.Sprint(i)}
+	}
+	clock := &MockClock{Time: time.Now()}
+	reviewer := NewCachedTokenReviewer(mock, time.Minute, clock).(*cachedTokenReviewer)
+
+	reviews := func(token string) int {
+		before := mock.Reviews
+		reviewer.ReviewToken(context.Background(), token)
+		return mock.Reviews - before
+	}
+
+	// Random tokens only push out other rejected tokens
+	reviews("user-0")
+	for i := 0; i <= maxRejectedTokens; i++ {
+		reviews(fmt.Sprintf("guess-%d", i))
+	}
+	if n := reviewer.rejected.len(); n != maxRejectedTokens {
+		t.Errorf("expected %d rejected tokens to be cached, got %d", maxRejectedTokens, n)
+	}
+	if reviews("user-0") != 0 {
+		t.Errorf("expected user-0 to still be cached")
+	}
+	if reviews(fmt.Sprintf("guess-%d", maxRejectedTokens)) != 0 {
+		t.Errorf("expected the newest rejected token to be cached")
+	}
+	if reviews("guess-0") != 1 {
+		t.Errorf("expected the oldest rejected token to have been evicted")
+	}
+
+	// A full cache makes room for new users by evicting the oldest
+	for i := 1; i <= maxCachedTokens; i++ {
+		reviews(fmt.Sprintf("user-%d", i))
+	}
+	if n := reviewer.accepted.len(); n != maxCachedTokens {
+		t.Errorf("expected %d users to be cached, got %d", maxCachedTokens, n)
+	}
+	if reviews(fmt.Sprintf("user-%d", maxCachedTokens)) != 0 {
+		t.Errorf("expected the newest user to be cached")
+	}
+	if reviews("user-0") != 1 {
+		t.Errorf("expected the oldest user to have been evicted")
+	}
+
+	// Expired reviews are dropped before anything that's still valid
+	clock.Time = clock.Time.Add(time.Minute)
+	reviews("user-1")
+	if n := reviewer.accepted.len(); n != 1 {
+		t.Errorf("expected only the new review to be cached, got %d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TracerProvider = trace.TracerProvider
+
+// tracerName identifies the spans started by this package
+const tracerName = "github.com/abatilo/okteto-exercise/internal"
+
+// NewNoopTracerProvider is used when tracing isn't configured, its spans are
+// never recorded or exported
+func NewNoopTracerProvider() TracerProvider {
+	return trace.NewNoopTracerProvider()
+}
+
+// NewOTLPTracerProvider exports spans over OTLP/HTTP to the collector at
+// endpoint, like http://localhost:4318. Spans are batched, Shutdown flushes
+// whatever hasn't been exported yet.
+func NewOTLPTracerProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: expected a URL like http://localhost:4318", endpoint)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	// The exporter appends its own path unless one is given
+	if u.Path != "" && u.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("podlist"),
+		)),
+	), nil
+}
+
+// tracedClient wraps a ControlPlaneClient with a span for every call that
+// reaches out to the cache or the API server
+type tracedClient struct {
+	ControlPlaneClient
+	tracer trace.Tracer
+}
+
+// NewTracedClient records a span for ListPods and Healthz. Spans are children
+// of whatever span is on the context, health checks run in the background so
+// theirs are usually the root of their own trace.
+func NewTracedClient(client ControlPlaneClient, tracerProvider TracerProvider) ControlPlaneClient {
+	return &tracedClient{
+		ControlPlaneClient: client,
+		tracer:             tracerProvider.Tracer(tracerName),
+	}
+}
+
+func (c *tracedClient) ListPods(ctx context.Context, opts PodListOptions) (*PodList, error) {
+	ctx, span := c.tracer.Start(ctx, "ControlPlaneClient.ListPods", trace.WithAttributes(
+		attribute.String("podlist.namespace", opts.Namespace),
+		attribute.Int64("podlist.limit", opts.Limit),
+		attribute.Bool("podlist.continue", opts.Continue != ""),
+		attribute.Bool("podlist.cache_synced", c.CacheSynced()),
+	))
+	defer span.End()
+
+	podList, err := c.ControlPlaneClient.ListPods(ctx, opts)
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("podlist.pods", len(podList.Items)))
+	return podList, nil
+}
+
+func (c *tracedClient) Healthz(ctx context.Context) Result {
+	ctx, span := c.tracer.Start(ctx, "ControlPlaneClient.Healthz")
+	defer span.End()
+
+	result := c.ControlPlaneClient.Healthz(ctx)
+	if err := result.Error(); err != nil {
+		recordError(span, err)
+	}
+	return result
+}
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func Test_NewOTLPTracerProvider(t *testing.T) {
+	// Stands in for an OpenTelemetry collector's OTLP/HTTP receiver
+	exported := make(chan *collectortrace.ExportTraceServiceRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected export to %s with content type %q", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var req collectortrace.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Errorf("failed to decode export: %v", err)
+		}
+		exported <- &req
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		b, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+		w.Write(b)
+	}))
+	defer collector.Close()
+
+	tp, err := NewOTLPTracerProvider(context.Background(), collector.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, span := tp.Tracer("test").Start(context.Background(), "GET /api/v1/pods")
+	span.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to flush spans: %v", err)
+	}
+
+	req := <-exported
+	if len(req.ResourceSpans) != 1 {
+		t.Fatalf("expected spans from 1 resource, got %d", len(req.ResourceSpans))
+	}
+	var service string
+	for _, attr := range req.ResourceSpans[0].Resource.Attributes {
+		if attr.Key == "service.name" {
+			service = attr.Value.GetStringValue()
+		}
+	}
+	if service != "podlist" {
+		t.Errorf("expected service.name podlist, got %q", service)
+	}
+	scopes := req.ResourceSpans[0].ScopeSpans
+	if len(scopes) != 1 || len(scopes[0].Spans) != 1 || scopes[0].Spans[0].Name != "GET /api/v1/pods" {
+		t.Errorf("expected the span GET /api/v1/pods to be exported, got %v", scopes)
+	}
+}
+
+func Test_NewOTLPTracerProviderInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"localhost:4318", "grpc://localhost:4317", "http://"} {
+		if _, err := NewOTLPTracerProvider(context.Background(), endpoint); err == nil {
+			t.Errorf("expected %q to be rejected", endpoint)
+		}
+	}
+}
+
+func Test_tracedClient(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	client := NewTracedClient(&MockKubernetesClient{
+		PodList: &PodList{Items: []Pod{
+			{ObjectMeta: ObjectMeta{Name: "web-1", Namespace: "default"}},
+			{ObjectMeta: ObjectMeta{Name: "web-2", Namespace: "default"}},
+		}},
+		Synced: true,
+	}, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	client.ListPods(context.Background(), PodListOptions{Namespace: "default", Limit: 10})
+	client.Healthz(context.Background())
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "ControlPlaneClient.ListPods" || spans[1].Name() != "ControlPlaneClient.Healthz" {
+		t.Fatalf("expected ListPods and Healthz spans, got %v", spans)
+	}
+	expected := map[attribute.Key]attribute.Value{
+		"podlist.namespace":    attribute.StringValue("default"),
+		"podlist.limit":        attribute.Int64Value(10),
+		"podlist.continue":     attribute.BoolValue(false),
+		"podlist.cache_synced": attribute.BoolValue(true),
+		"podlist.pods":         attribute.IntValue(2),
+	}
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, attr := range spans[0].Attributes() {
+		attributes[attr.Key] = attr.Value
+	}
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value.Emit(), attributes[key].Emit())
+		}
+	}
+}
+
+func Test_tracedClientError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	client := NewTracedClient(&MockKubernetesClient{
+		Error: errors.New("connection refused"),
+	}, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	if _, err := client.ListPods(context.Background(), PodListOptions{}); err == nil {
+		t.Fatalf("expected the client's error to be returned")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if status := spans[0].Status(); status.Code != codes.Error || status.Description != "connection refused" {
+		t.Errorf("expected an error status, got %+v", status)
+	}
+	if events := spans[0].Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("expected the error to be recorded, got %+v", events)
+	}
+}
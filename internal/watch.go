@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// ErrCacheNotSynced is returned when watching pods before the pod cache has
+// completed its initial list
+var ErrCacheNotSynced = errors.New("pod cache not synced")
+
+// PodEventType is the kind of change a PodEvent describes
+type PodEventType string
+
+const (
+	PodAdded    PodEventType = "ADDED"
+	PodModified PodEventType = "MODIFIED"
+	PodDeleted  PodEventType = "DELETED"
+)
+
+const (
+	// podEventHistory is how many events are kept around for watchers that
+	// reconnect and want to resume where they left off
+	podEventHistory = 1024
+
+	// podWatchBuffer is how many events a watcher can fall behind before it's
+	// dropped and has to reconnect
+	podWatchBuffer = 256
+)
+
+// PodEvent is a single change to a pod. IDs can be passed back to WatchPods
+// to resume a watch. They look like "<epoch>-<sequence>", where the epoch is
+// different in every process, so an ID from another replica or from before a
+// restart is never mistaken for one of ours.
+type PodEvent struct {
+	ID   string
+	Type PodEventType
+	Pod  *Pod
+}
+
+// PodWatch is a stream of pod events. Initial holds the events a watcher
+// needs to catch up, either every pod that currently exists when Snapshot is
+// true, or only the events missed since the ID that was resumed from. Events
+// is closed when the watch's context ends or the watcher falls too far behind.
+type PodWatch struct {
+	Snapshot bool
+	Initial  []PodEvent
+	Events   <-chan PodEvent
+}
+
+// podChange is a recorded informer notification. Both versions of the pod are
+// kept so that a watcher whose selector stops or starts matching sees a
+// DELETED or ADDED event rather than a MODIFIED one.
+type podChange struct {
+	id     uint64
+	oldPod *Pod
+	newPod *Pod
+}
+
+// eventType is the event a watcher with the given options should see for the
+// change, if any
+func (c podChange) eventType(opts PodListOptions) (PodEventType, *Pod, bool) {
+	oldMatch := c.oldPod != nil && opts.matchesWithNamespace(c.oldPod)
+	newMatch := c.newPod != nil && opts.matchesWithNamespace(c.newPod)
+
+	switch {
+	case oldMatch && newMatch:
+		return PodModified, c.newPod, true
+	case newMatch:
+		return PodAdded, c.newPod, true
+	case oldMatch:
+		return PodDeleted, c.oldPod, true
+	}
+	return "", nil, false
+}
+
+type podWatcher struct {
+	opts   PodListOptions
+	events chan PodEvent
+}
+
+// podBroadcaster fans informer notifications out to every active watcher and
+// keeps a short history for watchers that resume
+type podBroadcaster struct {
+	// epoch prefixes every event ID
+	epoch string
+
+	mu       sync.Mutex
+	lastID   uint64
+	history  []podChange
+	watchers map[*podWatcher]struct{}
+}
+
+func newPodBroadcaster() *podBroadcaster {
+	return &podBroadcaster{
+		epoch:    newEpoch(),
+		watchers: map[*podWatcher]struct{}{},
+	}
+}
+
+func newEpoch() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (b *podBroadcaster) eventID(id uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+// parseEventID returns the sequence number of one of our event IDs, ok is
+// false for IDs from another epoch and anything that isn't an ID
+func (b *podBroadcaster) parseEventID(eventID string) (id uint64, ok bool) {
+	epoch, seq, found := strings.Cut(eventID, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(seq, 10, 64)
+	return id, err == nil
+}
+
+// eventFor translates a change into the event a watcher with the given
+// options should see, if any
+func (b *podBroadcaster) eventFor(c podChange, opts PodListOptions) (PodEvent, bool) {
+	eventType, pod, ok := c.eventType(opts)
+	if !ok {
+		return PodEvent{}, false
+	}
+	return PodEvent{ID: b.eventID(c.id), Type: eventType, Pod: pod}, true
+}
+
+// handler returns the informer event handler feeding the broadcaster
+func (b *podBroadcaster) handler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if p, ok := obj.(*Pod); ok {
+				b.publish(nil, p)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*Pod)
+			if !ok {
+				return
+			}
+			newPod, ok := newObj.(*Pod)
+			if !ok {
+				return
+			}
+			// Periodic resyncs replay pods that haven't changed
+			if oldPod.ResourceVersion == newPod.ResourceVersion {
+				return
+			}
+			b.publish(oldPod, newPod)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if p, ok := obj.(*Pod); ok {
+				b.publish(p, nil)
+			}
+		},
+	}
+}
+
+func (b *podBroadcaster) publish(oldPod, newPod *Pod) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	change := podChange{id: b.lastID, oldPod: oldPod, newPod: newPod}
+
+	b.history = append(b.history, change)
+	if len(b.history) > podEventHistory {
+		b.history = b.history[len(b.history)-podEventHistory:]
+	}
+
+	for w := range b.watchers {
+		event, ok := b.eventFor(change, w.opts)
+		if !ok {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+			// Never block the informer on a slow watcher, it'll have to
+			// resume from its last event
+			delete(b.watchers, w)
+			close(w.events)
+		}
+	}
+}
+
+// subscribe registers a watcher. When lastEventID is one of ours and still
+// within the history the missed events are returned, otherwise snapshot is
+// called to build a full list of ADDED events.
+func (b *podBroadcaster) subscribe(opts PodListOptions, lastEventID string, snapshot func() ([]Pod, error)) (*PodWatch, *podWatcher, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	watch := &PodWatch{}
+	if lastID, ok := b.parseEventID(lastEventID); ok && lastID > 0 && b.canResume(lastID) {
+		for _, change := range b.history {
+			if change.id <= lastID {
+				continue
+			}
+			if event, ok := b.eventFor(change, opts); ok {
+				watch.Initial = append(watch.Initial, event)
+			}
+		}
+	} else {
+		pods, err := snapshot()
+		if err != nil {
+			return nil, nil, err
+		}
+		watch.Snapshot = true
+		watch.Initial = make([]PodEvent, len(pods))
+		for i := range pods {
+			watch.Initial[i] = PodEvent{ID: b.eventID(b.lastID), Type: PodAdded, Pod: &pods[i]}
+		}
+	}
+
+	w := &podWatcher{
+		opts:   opts,
+		events: make(chan PodEvent, podWatchBuffer),
+	}
+	b.watchers[w] = struct{}{}
+	watch.Events = w.events
+	return watch, w, nil
+}
+
+// canResume reports whether every event after lastID is still in the history
+func (b *podBroadcaster) canResume(lastID uint64) bool {
+	if lastID > b.lastID {
+		return false
+	}
+	if len(b.history) == 0 {
+		return lastID == b.lastID
+	}
+	return lastID >= b.history[0].id-1
+}
+
+func (b *podBroadcaster) unsubscribe(w *podWatcher) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.watchers[w]; ok {
+		delete(b.watchers, w)
+		close(w.events)
+	}
+}
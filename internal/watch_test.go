@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func Test_podBroadcaster(t *testing.T) {
+	pod := func(name, app, resourceVersion string) *Pod {
+		return &Pod{ObjectMeta: ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			Labels:          map[string]string{"app": app},
+			ResourceVersion: resourceVersion,
+		}}
+	}
+	eventTypes := func(events []PodEvent) []PodEventType {
+		types := []PodEventType{}
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		return types
+	}
+	noSnapshot := func() ([]Pod, error) {
+		t.Fatal("unexpected snapshot")
+		return nil, nil
+	}
+
+	b := newPodBroadcaster()
+	h := b.handler()
+	frontend := PodListOptions{LabelSelector: labels.SelectorFromSet(labels.Set{"app": "frontend"})}
+
+	h.OnAdd(pod("AAA", "frontend", "1"))
+	watch, w, err := b.subscribe(frontend, "", func() ([]Pod, error) {
+		return []Pod{*pod("AAA", "frontend", "1")}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %v", err)
+	}
+	if !watch.Snapshot || len(watch.Initial) != 1 || watch.Initial[0].ID != b.eventID(1) {
+		t.Errorf("expected a snapshot of 1 pod at event 1, got %+v", watch)
+	}
+
+	// Changing labels moves a pod in and out of the watcher's selector
+	h.OnAdd(pod("BBB", "backend", "2"))
+	h.OnUpdate(pod("BBB", "backend", "2"), pod("BBB", "frontend", "3"))
+	h.OnUpdate(pod("AAA", "frontend", "1"), pod("AAA", "frontend", "1"))
+	h.OnUpdate(pod("AAA", "frontend", "1"), pod("AAA", "frontend", "4"))
+	h.OnUpdate(pod("BBB", "frontend", "3"), pod("BBB", "backend", "5"))
+	h.OnDelete(pod("AAA", "frontend", "4"))
+
+	expected := []PodEventType{PodAdded, PodModified, PodDeleted, PodDeleted}
+	received := []PodEvent{}
+	for range expected {
+		received = append(received, <-watch.Events)
+	}
+	if !reflect.DeepEqual(eventTypes(received), expected) {
+		t.Errorf("expected events %v, got %v", expected, eventTypes(received))
+	}
+	b.unsubscribe(w)
+
+	// Resuming replays only what was missed
+	watch, w, _ = b.subscribe(frontend, received[1].ID, noSnapshot)
+	if watch.Snapshot || !reflect.DeepEqual(eventTypes(watch.Initial), expected[2:]) {
+		t.Errorf("expected to resume with %v, got %v", expected[2:], eventTypes(watch.Initial))
+	}
+	b.unsubscribe(w)
+
+	// IDs from another process, which could fall within our history, and
+	// anything that isn't an ID fall back to a snapshot
+	restarted := newPodBroadcaster()
+	restarted.handler().OnAdd(pod("EEE", "frontend", "1"))
+	restarted.handler().OnAdd(pod("EEE", "frontend", "2"))
+	for _, lastEventID := range []string{received[1].ID, "2", "not-an-id"} {
+		watch, w, _ = restarted.subscribe(frontend, lastEventID, func() ([]Pod, error) {
+			return []Pod{*pod("EEE", "frontend", "2")}, nil
+		})
+		if !watch.Snapshot || len(watch.Initial) != 1 {
+			t.Errorf("%s: expected a snapshot, got %+v", lastEventID, watch)
+		}
+		restarted.unsubscribe(w)
+	}
+
+	// Resuming from before the history starts falls back to a snapshot
+	for i := 0; i < podEventHistory; i++ {
+		h.OnAdd(pod("CCC", "backend", "6"))
+	}
+	watch, w, _ = b.subscribe(frontend, received[1].ID, func() ([]Pod, error) {
+		return nil, nil
+	})
+	if !watch.Snapshot {
+		t.Error("expected a snapshot when resuming from an event that's no longer kept")
+	}
+
+	// A watcher that falls behind is dropped rather than blocking
+	for i := 0; i <= podWatchBuffer; i++ {
+		h.OnAdd(pod("DDD", "frontend", "7"))
+	}
+	count := 0
+	for range watch.Events {
+		count++
+	}
+	if count != podWatchBuffer {
+		t.Errorf("expected %d buffered events before the watcher was dropped, got %d", podWatchBuffer, count)
+	}
+	b.unsubscribe(w)
+}